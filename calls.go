@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+import (
+	hl "github.com/c0rner/hldump/internal/hashlink"
+)
+
+func runCalls(args []string) error {
+	fs := newFlagSet("calls")
+	asJSON := fs.Bool("json", false, "output JSON")
+	indirect := fs.Bool("indirect", false, "list only method and closure calls")
+	fs.Parse(args)
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		usage()
+	}
+
+	hlb, err := LoadCode(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer hlb.Close()
+
+	var res []hl.FunctionCalls
+	if fs.NArg() == 2 {
+		i, ok := findFunction(hlb, fs.Arg(1))
+		if !ok {
+			return fmt.Errorf("unknown function %q", fs.Arg(1))
+		}
+		res = []hl.FunctionCalls{{FuncRef: hl.FuncRef{Index: i, Name: hlb.FunctionName(i)}, Sites: hlb.CallSites(i)}}
+	} else {
+		res = hlb.Calls()
+	}
+	if *indirect {
+		for i := range res {
+			var sites []hl.CallSite
+			for _, s := range res[i].Sites {
+				if s.Kind != hl.CallDirect {
+					sites = append(sites, s)
+				}
+			}
+			res[i].Sites = sites
+		}
+	}
+
+	if *asJSON {
+		return writeJSON(res)
+	}
+	for _, fn := range res {
+		if len(fn.Sites) == 0 {
+			continue
+		}
+		fmt.Printf("fun@%d %s\n", fn.Index, fn.Name)
+		for _, s := range fn.Sites {
+			targets := make([]string, len(s.Targets))
+			for i, t := range s.Targets {
+				targets[i] = t.Name
+				if ref := fmt.Sprintf("fun@%d", t.Index); ref != t.Name {
+					targets[i] += " " + ref
+				}
+			}
+			if len(targets) == 0 {
+				targets = []string{"?"}
+			}
+			method := ""
+			if s.Method != "" {
+				method = " ." + s.Method
+			}
+			fmt.Printf("\t@%d %s%s -> %s\n", s.PC, s.Kind, method, strings.Join(targets, ", "))
+		}
+	}
+	return nil
+}
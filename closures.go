@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+)
+
+func runClosures(args []string) error {
+	fs := newFlagSet("closures")
+	asJSON := fs.Bool("json", false, "output JSON")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		usage()
+	}
+
+	hlb, err := LoadCode(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer hlb.Close()
+
+	res := hlb.Closures()
+	if *asJSON {
+		return writeJSON(res)
+	}
+	for _, c := range res {
+		fmt.Printf("fun@%d %s ; created by %s @%d", c.Index, c.Name, c.Owner.Name, c.PC)
+		if c.Env != "" {
+			fmt.Printf(", captures %s", c.Env)
+		}
+		fmt.Println()
+	}
+	return nil
+}
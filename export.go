@@ -0,0 +1,483 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+import (
+	hl "github.com/c0rner/hldump/internal/hashlink"
+)
+
+var errExportFormat = errors.New("unknown export format, want ghidra, idc or json")
+
+// exportField is a struct member at a fixed offset. Type is a C type
+// and Comment the HashLink type it stands for.
+type exportField struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Offset  int    `json:"offset"`
+	Size    int    `json:"size"`
+	Comment string `json:"comment"`
+}
+
+type exportStruct struct {
+	Name   string        `json:"name"`
+	HLName string        `json:"hlName"`
+	Size   int           `json:"size"`
+	Fields []exportField `json:"fields"`
+}
+
+type exportValue struct {
+	Name  string `json:"name"`
+	Value int    `json:"value"`
+}
+
+type exportEnum struct {
+	Name   string        `json:"name"`
+	HLName string        `json:"hlName"`
+	Values []exportValue `json:"values"`
+}
+
+// exportFunction maps the C symbol of a native or HL/C compiled
+// function to its name in the module. Ret and Args are C types.
+type exportFunction struct {
+	Index   int      `json:"index"`
+	Symbol  string   `json:"symbol"`
+	Name    string   `json:"name"`
+	Native  bool     `json:"native,omitempty"`
+	Ret     string   `json:"ret"`
+	Args    []string `json:"args"`
+	Comment string   `json:"comment"`
+}
+
+// exportData is the module information handed to native disassemblers
+type exportData struct {
+	File      string           `json:"file"`
+	PtrSize   int              `json:"ptrSize"`
+	Structs   []exportStruct   `json:"structs"`
+	Enums     []exportEnum     `json:"enums"`
+	Functions []exportFunction `json:"functions"`
+}
+
+// cKeywords are the C keywords HashLink field names may collide with
+var cKeywords = map[string]bool{
+	"auto": true, "char": true, "const": true, "double": true, "extern": true,
+	"float": true, "int": true, "long": true, "register": true, "short": true,
+	"signed": true, "sizeof": true, "static": true, "struct": true, "union": true,
+	"unsigned": true, "void": true, "volatile": true, "bool": true, "goto": true,
+}
+
+// cIdent turns s into a C identifier
+func cIdent(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if c != '_' && (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (c < '0' || c > '9' || i == 0) {
+			b[i] = '_'
+		}
+	}
+	if len(b) == 0 || cKeywords[string(b)] {
+		return "_" + string(b)
+	}
+	return string(b)
+}
+
+// exporter assigns unique C names to the classes and enums of a module
+type exporter struct {
+	hlb   *hl.Data
+	ptr   int
+	types []hl.TypeInfo
+	names map[int]string
+	used  map[string]bool
+}
+
+// unique returns name, or name suffixed with i if already taken
+func (x *exporter) unique(name string, i int) string {
+	if x.used[name] {
+		name += "_" + strconv.Itoa(i)
+	}
+	x.used[name] = true
+	return name
+}
+
+// cType returns the C type of values of type t. Classes are pointers
+// to their struct, other references untyped pointers.
+func (x *exporter) cType(t int) string {
+	if t < 0 || t >= len(x.types) {
+		return "void *"
+	}
+	switch x.types[t].Kind {
+	case "void":
+		return "void"
+	case "ui8":
+		return "unsigned char"
+	case "ui16":
+		return "unsigned short"
+	case "i32":
+		return "int"
+	case "i64":
+		return "long long"
+	case "f32":
+		return "float"
+	case "f64":
+		return "double"
+	case "bool":
+		return "bool"
+	case "obj":
+		return x.names[t] + " *"
+	}
+	return "void *"
+}
+
+func (x *exporter) fields(l []hl.FieldLayout) []exportField {
+	res := make([]exportField, 0, len(l))
+	for _, f := range l {
+		res = append(res, exportField{cIdent(f.Name), x.cType(f.TypeIndex), f.Offset, f.Size, f.Type})
+	}
+	return res
+}
+
+// export collects the class layouts, enums and function symbols of
+// the module. Objects and enum values start with a pointer to their
+// runtime type, named t as in the HashLink headers.
+func (x *exporter) export() *exportData {
+	res := &exportData{PtrSize: x.ptr}
+	for _, t := range x.types {
+		switch t.Kind {
+		case "obj":
+			x.names[t.Index] = x.unique(cIdent(t.Name), t.Index)
+		case "enum":
+			if strings.HasPrefix(t.Name, "env<") {
+				x.names[t.Index] = x.unique("env_"+strconv.Itoa(t.Index), t.Index)
+			} else {
+				x.names[t.Index] = x.unique(cIdent(t.Name), t.Index)
+			}
+		}
+	}
+	header := []exportField{{"t", "void *", 0, x.ptr, "type"}}
+	for _, t := range x.types {
+		if s, ok := x.hlb.ObjLayout(t.Index, x.ptr); ok {
+			res.Structs = append(res.Structs, exportStruct{x.names[t.Index], s.Name, s.Size, append(header, x.fields(s.Fields)...)})
+		}
+		e, ok := x.hlb.EnumLayout(t.Index, x.ptr)
+		if !ok {
+			continue
+		}
+		ee := exportEnum{Name: x.names[t.Index], HLName: e.Name}
+		for _, c := range e.Constructs {
+			name := x.names[t.Index] + "_" + cIdent(c.Name)
+			ee.Values = append(ee.Values, exportValue{name, c.Index})
+			if len(c.Fields) == 0 {
+				continue
+			}
+			fields := append(header, exportField{"index", "int", x.ptr, 4, x.names[t.Index]})
+			res.Structs = append(res.Structs, exportStruct{x.unique(name, t.Index), e.Name + "." + c.Name, c.Size, append(fields, x.fields(c.Fields)...)})
+		}
+		res.Enums = append(res.Enums, ee)
+	}
+
+	add := func(i int, native bool) {
+		f := exportFunction{Index: i, Symbol: x.hlb.CFunctionName(i), Name: x.hlb.FunctionName(i), Native: native}
+		args, ret, ok := x.hlb.FunctionArgs(i)
+		if !ok {
+			return
+		}
+		f.Ret = x.cType(ret)
+		f.Args = make([]string, len(args))
+		for j, a := range args {
+			f.Args[j] = x.cType(a)
+		}
+		f.Comment = f.Name + " : " + x.types[x.hlb.FunctionType(i)].Name
+		if ref := "fun@" + strconv.Itoa(i); ref != f.Name {
+			f.Comment = ref + " " + f.Comment
+		}
+		res.Functions = append(res.Functions, f)
+	}
+	for _, lib := range x.hlb.Natives() {
+		for _, n := range lib.Natives {
+			add(n.Index, true)
+		}
+	}
+	for _, f := range x.hlb.Functions() {
+		add(f.Index, false)
+	}
+	return res
+}
+
+// cDecl returns the C declaration of s, padding members to the offsets
+// given by the HashLink layout
+func cDecl(s *exportStruct) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "struct %s {\n", s.Name)
+	off := 0
+	for _, f := range s.Fields {
+		if f.Size == 0 {
+			continue
+		}
+		if f.Offset > off {
+			fmt.Fprintf(&b, "\tunsigned char _pad%d[%d];\n", off, f.Offset-off)
+		}
+		if strings.HasSuffix(f.Type, "*") {
+			fmt.Fprintf(&b, "\t%s%s;\n", f.Type, f.Name)
+		} else {
+			fmt.Fprintf(&b, "\t%s %s;\n", f.Type, f.Name)
+		}
+		off = f.Offset + f.Size
+	}
+	b.WriteString("};")
+	return b.String()
+}
+
+// idcString quotes s as an IDC string literal
+func idcString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, c := range []byte(s) {
+		switch {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c == '\n':
+			b.WriteString("\\n")
+		case c == '\t':
+			b.WriteString("\\t")
+		case c < ' ' || c > '~':
+			fmt.Fprintf(&b, "\\x%02x", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// cPrototype returns the C prototype of f as parsed by IDA
+func cPrototype(f *exportFunction) string {
+	args := "void"
+	if len(f.Args) > 0 {
+		args = strings.Join(f.Args, ", ")
+	}
+	return fmt.Sprintf("%s f(%s);", f.Ret, args)
+}
+
+const idcHeader = `// IDC script generated by hldump from %s
+#include <idc.idc>
+
+// hl_find returns the address of symbol name, or BADADDR
+static hl_find(name) {
+	auto ea = get_name_ea_simple(name);
+	if (ea == BADADDR)
+		ea = get_name_ea_simple("_" + name);
+	return ea;
+}
+
+// hl_native types and comments the native implemented by symbol sym
+static hl_native(sym, cmt, type) {
+	auto ea = hl_find(sym);
+	if (ea == BADADDR)
+		return 0;
+	set_func_cmt(ea, cmt, 1);
+	SetType(ea, type);
+	return 1;
+}
+
+// hl_function names, types and comments the HL/C function sym
+static hl_function(sym, name, cmt, type) {
+	auto ea = hl_find(sym);
+	if (ea == BADADDR)
+		return 0;
+	set_name(ea, name, SN_NOCHECK | SN_NOWARN);
+	set_func_cmt(ea, cmt, 1);
+	SetType(ea, type);
+	return 1;
+}
+
+static main() {
+	auto n = 0;
+	if (((get_inf_attr(INF_LFLAGS) & LFLG_64BIT) ? 8 : 4) != %d)
+		msg("hldump: layouts computed for %d byte pointers\n");
+`
+
+func writeIDC(w io.Writer, x *exportData) error {
+	fmt.Fprintf(w, idcHeader, x.File, x.PtrSize, x.PtrSize)
+	for _, s := range x.Structs {
+		fmt.Fprintf(w, "\tparse_decls(%s, 0);\n", idcString("struct "+s.Name+";"))
+	}
+	for _, e := range x.Enums {
+		l := make([]string, len(e.Values))
+		for i, v := range e.Values {
+			l[i] = fmt.Sprintf("%s = %d", v.Name, v.Value)
+		}
+		fmt.Fprintf(w, "\tparse_decls(%s, 0);\n", idcString("enum "+e.Name+" { "+strings.Join(l, ", ")+" };"))
+	}
+	for i := range x.Structs {
+		fmt.Fprintf(w, "\tparse_decls(%s, 0);\n", idcString(cDecl(&x.Structs[i])))
+	}
+	for i := range x.Functions {
+		f := &x.Functions[i]
+		if f.Native {
+			fmt.Fprintf(w, "\tn = n + hl_native(%s, %s, %s);\n", idcString(f.Symbol), idcString(f.Comment), idcString(cPrototype(f)))
+		} else {
+			fmt.Fprintf(w, "\tn = n + hl_function(%s, %s, %s, %s);\n", idcString(f.Symbol), idcString(f.Name), idcString(f.Comment), idcString(cPrototype(f)))
+		}
+	}
+	_, err := fmt.Fprintf(w, "\tmsg(\"hldump: %d structs, %d enums, %%d of %d functions found\\n\", n);\n}\n", len(x.Structs), len(x.Enums), len(x.Functions))
+	return err
+}
+
+const ghidraScript = `# -*- coding: utf-8 -*-
+# Ghidra script generated by hldump from %s
+#@category HashLink
+import json
+from ghidra.app.cmd.function import ApplyFunctionSignatureCmd
+from ghidra.program.model.data import (BooleanDataType, CategoryPath,
+    DataTypeConflictHandler, DoubleDataType, EnumDataType, FloatDataType,
+    FunctionDefinitionDataType, IntegerDataType, LongLongDataType,
+    ParameterDefinitionImpl, PointerDataType, StructureDataType,
+    UnsignedCharDataType, UnsignedShortDataType, VoidDataType)
+from ghidra.program.model.symbol import SourceType
+
+DATA = json.loads(r'''%s''')
+
+dtm = currentProgram.getDataTypeManager()
+cat = CategoryPath("/hashlink")
+replace = DataTypeConflictHandler.REPLACE_HANDLER
+if currentProgram.getDefaultPointerSize() != DATA["ptrSize"]:
+    print("hldump: layouts computed for %%d byte pointers" %% DATA["ptrSize"])
+
+BASIC = {
+    "void": VoidDataType.dataType,
+    "unsigned char": UnsignedCharDataType.dataType,
+    "unsigned short": UnsignedShortDataType.dataType,
+    "int": IntegerDataType.dataType,
+    "long long": LongLongDataType.dataType,
+    "float": FloatDataType.dataType,
+    "double": DoubleDataType.dataType,
+    "bool": BooleanDataType.dataType,
+}
+
+structs = {}
+for s in DATA["structs"]:
+    dt = StructureDataType(cat, s["name"], s["size"], dtm)
+    dt.setDescription(s["hlName"])
+    structs[s["name"]] = dtm.addDataType(dt, replace)
+
+def ctype(t):
+    if t in BASIC:
+        return BASIC[t]
+    if t.endswith(" *") and t[:-2] in structs:
+        return PointerDataType(structs[t[:-2]], dtm)
+    return PointerDataType.dataType
+
+for s in DATA["structs"]:
+    dt = structs[s["name"]]
+    for f in s["fields"]:
+        if f["size"] > 0:
+            dt.replaceAtOffset(f["offset"], ctype(f["type"]), f["size"], f["name"], f["comment"])
+
+for e in DATA["enums"]:
+    dt = EnumDataType(cat, e["name"], 4, dtm)
+    dt.setDescription(e["hlName"])
+    for v in e["values"]:
+        dt.add(v["name"], v["value"])
+    dtm.addDataType(dt, replace)
+
+def find(name):
+    for n in (name, "_" + name):
+        for s in currentProgram.getSymbolTable().getGlobalSymbols(n):
+            f = getFunctionAt(s.getAddress())
+            if f is not None:
+                return f
+    return None
+
+found = 0
+for f in DATA["functions"]:
+    fn = find(f["symbol"])
+    if fn is None:
+        continue
+    found += 1
+    ep = fn.getEntryPoint()
+    if f["native"]:
+        createLabel(ep, f["name"], False)
+    else:
+        fn.setName(f["name"], SourceType.IMPORTED)
+    sig = FunctionDefinitionDataType(fn.getName())
+    sig.setReturnType(ctype(f["ret"]))
+    sig.setArguments([ParameterDefinitionImpl("a%%d" %% i, ctype(a), None) for i, a in enumerate(f["args"])])
+    ApplyFunctionSignatureCmd(ep, sig, SourceType.IMPORTED).applyTo(currentProgram)
+    setPlateComment(ep, f["comment"])
+
+print("hldump: %%d structs, %%d enums, %%d of %%d functions found" %% (
+    len(DATA["structs"]), len(DATA["enums"]), found, len(DATA["functions"])))
+`
+
+func writeGhidra(w io.Writer, x *exportData) error {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(x); err != nil {
+		return err
+	}
+	// Quotes only occur in JSON strings, where ' reads back the
+	// same and cannot end the raw Python string
+	data := strings.Replace(strings.TrimSpace(b.String()), "'", `\u0027`, -1)
+	_, err := fmt.Fprintf(w, ghidraScript, x.File, data)
+	return err
+}
+
+func runExport(args []string) error {
+	fs := newFlagSet("export")
+	format := fs.String("format", "ghidra", "output `format`: ghidra (Python script), idc or json")
+	ptr := fs.Int("ptr", 8, "pointer size of the native executable in bytes")
+	out := fs.String("o", "", "write to `file` instead of stdout")
+	fs.Parse(args)
+	if fs.NArg() != 1 || (*ptr != 4 && *ptr != 8) {
+		usage()
+	}
+
+	var write func(io.Writer, *exportData) error
+	switch *format {
+	case "ghidra":
+		write = writeGhidra
+	case "idc":
+		write = writeIDC
+	case "json":
+		write = func(w io.Writer, x *exportData) error {
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "  ")
+			enc.SetEscapeHTML(false)
+			return enc.Encode(x)
+		}
+	default:
+		return errExportFormat
+	}
+
+	hlb, err := LoadCode(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer hlb.Close()
+	x := &exporter{hlb: hlb, ptr: *ptr, types: hlb.Types(), names: make(map[int]string), used: make(map[string]bool)}
+	data := x.export()
+	data.File = filepath.Base(fs.Arg(0))
+
+	if *out == "" {
+		return write(os.Stdout, data)
+	}
+	f, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	if err := write(f, data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
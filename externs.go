@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+func runExterns(args []string) error {
+	fs := newFlagSet("externs")
+	out := fs.String("o", "externs", "write the .hx files below `dir`")
+	std := fs.Bool("std", false, "include the types and natives of the Haxe standard library")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		usage()
+	}
+
+	hlb, err := LoadHLB(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer hlb.Close()
+
+	for _, f := range hlb.HaxeExterns(*std) {
+		name := filepath.Join(*out, filepath.FromSlash(f.Path))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(name, []byte(f.Source), 0644); err != nil {
+			return err
+		}
+		fmt.Println(name)
+	}
+	return nil
+}
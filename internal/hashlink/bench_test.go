@@ -0,0 +1,30 @@
+package hashlink
+
+import (
+	"runtime"
+	"testing"
+)
+
+func benchmarkDecode(b *testing.B, opt *Options) {
+	buf := syntheticModule(20000, 100)
+	b.SetBytes(int64(len(buf)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := NewDataOptions(buf, opt); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeEager(b *testing.B) {
+	benchmarkDecode(b, &Options{})
+}
+
+func BenchmarkDecodeLazy(b *testing.B) {
+	benchmarkDecode(b, &Options{LazyCode: true})
+}
+
+func BenchmarkDecodeParallel(b *testing.B) {
+	benchmarkDecode(b, &Options{Workers: runtime.NumCPU()})
+}
@@ -0,0 +1,254 @@
+package hashlink
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// CallKind tells how a call instruction selects its callee
+type CallKind string
+
+const (
+	// The callee is encoded in the instruction
+	CallDirect CallKind = "direct"
+
+	// The callee is looked up in the method table of the receiver
+	CallMethod CallKind = "method"
+
+	// The callee is the function of a closure value
+	CallClosure CallKind = "closure"
+)
+
+// CallSite is an instruction calling, or binding into a closure, one
+// of a set of functions. An empty target list means the callee could
+// not be resolved.
+type CallSite struct {
+	PC      int       `json:"pc"`
+	Kind    CallKind  `json:"kind"`
+	Method  string    `json:"method,omitempty"`
+	Targets []FuncRef `json:"targets"`
+}
+
+// FunctionCalls lists the call sites of a function
+type FunctionCalls struct {
+	FuncRef
+	Sites []CallSite `json:"sites"`
+}
+
+// Calls returns the call sites of every bytecode function, in function
+// order, skipping functions that call nothing.
+func (d *Data) Calls() []FunctionCalls {
+	var res []FunctionCalls
+	for _, f := range d.functions {
+		if sites := d.callSites(f, d.analyze(f)); len(sites) > 0 {
+			res = append(res, FunctionCalls{FuncRef{f.funcIdx, d.FunctionName(f.funcIdx)}, sites})
+		}
+	}
+	return res
+}
+
+// CallSites returns the call sites of function fn with their possible
+// callees, or nil if fn is not a bytecode function. Method calls are
+// resolved by class hierarchy analysis: the method bound to the slot
+// in the receiver class or any of its subclasses may run. Calls
+// through a virtual may reach any method of the same name. Closures
+// created in the function are followed to their definition, others
+// may be any function turned into a closure of the same type.
+func (d *Data) CallSites(fn int) []CallSite {
+	f, ok := d.LookupFunction(fn).(*hlFunction)
+	if !ok {
+		return nil
+	}
+	return d.callSites(f, d.analyze(f))
+}
+
+func (d *Data) callSites(f *hlFunction, an *Analysis) []CallSite {
+	var res []CallSite
+	code := f.code()
+	for pc := range code {
+		o := &code[pc]
+		a, x := o.args(), o.extra()
+		site := CallSite{PC: pc, Kind: CallMethod}
+		var targets []int
+		switch o.op {
+		case OpCall0, OpCall1, OpCall2, OpCall3, OpCall4, OpCallN,
+			OpStaticClosure, OpInstanceClosure:
+			site.Kind = CallDirect
+			targets = []int{a[1]}
+		case OpCallMethod:
+			if len(x) == 0 {
+				continue
+			}
+			t := d.regType(f, x[0])
+			site.Method = d.methodName(t, a[1])
+			targets = d.methodTargets(t, a[1])
+		case OpCallThis:
+			t := d.regType(f, 0)
+			site.Method = d.methodName(t, a[1])
+			targets = d.methodTargets(t, a[1])
+		case OpVirtualClosure:
+			t := d.regType(f, a[1])
+			site.Method = d.methodName(t, a[2])
+			targets = d.methodTargets(t, a[2])
+		case OpCallClosure:
+			site.Kind = CallClosure
+			targets = d.closureTargets(f, an, pc, a[1], make(map[int]bool))
+		default:
+			continue
+		}
+		site.Targets = make([]FuncRef, 0, len(targets))
+		for _, t := range uniqueInts(targets) {
+			site.Targets = append(site.Targets, FuncRef{t, d.FunctionName(t)})
+		}
+		res = append(res, site)
+	}
+	return res
+}
+
+// maxTargets is the number of callees listed by TargetList
+const maxTargets = 8
+
+// TargetList formats the callees of s as noted in listings,
+// abbreviating long lists
+func (s *CallSite) TargetList() string {
+	if len(s.Targets) == 0 {
+		return "-> ?"
+	}
+	var l []string
+	for i, t := range s.Targets {
+		if i == maxTargets {
+			l = append(l, fmt.Sprintf("+%d more", len(s.Targets)-i))
+			break
+		}
+		l = append(l, t.Name)
+	}
+	return "-> " + strings.Join(l, " | ")
+}
+
+// subclassesOf returns the classes directly extending t
+func (d *Data) subclassesOf(t *ObjType) []*ObjType {
+	if d.subclasses == nil {
+		d.subclasses = make(map[*ObjType][]*ObjType)
+		for _, t := range d.types {
+			if o, ok := t.(*ObjType); ok && o.superPtr != nil {
+				d.subclasses[o.superPtr] = append(d.subclasses[o.superPtr], o)
+			}
+		}
+	}
+	return d.subclasses[t]
+}
+
+// methodTargets returns the functions that may run when calling method
+// slot i of a value of type t
+func (d *Data) methodTargets(t hlType, i int) []int {
+	var res []int
+	switch t := t.(type) {
+	case *ObjType:
+		if p := t.proto(i); p != nil {
+			res = append(res, p.funcIdx)
+		}
+		work := append([]*ObjType(nil), d.subclassesOf(t)...)
+		for len(work) > 0 {
+			o := work[len(work)-1]
+			work = append(work[:len(work)-1], d.subclassesOf(o)...)
+			for _, p := range o.lProto {
+				if p.override == i {
+					res = append(res, p.funcIdx)
+				}
+			}
+		}
+	case *VirtualType:
+		if i < 0 || i >= len(t.field) {
+			return nil
+		}
+		name := t.field[i].nameIdx
+		for _, t := range d.types {
+			if o, ok := t.(*ObjType); ok {
+				for _, p := range o.lProto {
+					if p.nameIdx == name {
+						res = append(res, p.funcIdx)
+					}
+				}
+			}
+		}
+	}
+	return res
+}
+
+// closureTargets returns the functions that may be held by register r
+// when read by instruction pc. Moves are followed through seen, which
+// holds the chains already visited.
+func (d *Data) closureTargets(f *hlFunction, an *Analysis, pc, r int, seen map[int]bool) []int {
+	var res []int
+	code := f.code()
+	for _, c := range an.Reaching(pc) {
+		du := an.Chains[c]
+		if du.Reg != r || seen[c] {
+			continue
+		}
+		seen[c] = true
+		if du.Def < 0 {
+			res = append(res, d.closuresOfType(f.regIdx[r])...)
+			continue
+		}
+		o := &code[du.Def]
+		a := o.args()
+		switch o.op {
+		case OpStaticClosure, OpInstanceClosure:
+			res = append(res, a[1])
+		case OpVirtualClosure:
+			res = append(res, d.methodTargets(d.regType(f, a[1]), a[2])...)
+		case OpMov, OpSafeCast, OpUnsafeCast:
+			res = append(res, d.closureTargets(f, an, du.Def, a[1], seen)...)
+		default:
+			res = append(res, d.closuresOfType(f.regIdx[r])...)
+		}
+	}
+	return res
+}
+
+// closuresOfType returns the functions turned into a closure of type
+// typeIdx anywhere in the module
+func (d *Data) closuresOfType(typeIdx int) []int {
+	if d.closures == nil {
+		d.closures = make(map[int][]int)
+		for _, f := range d.functions {
+			code := f.code()
+			for pc := range code {
+				o := &code[pc]
+				a := o.args()
+				var l []int
+				switch o.op {
+				case OpStaticClosure, OpInstanceClosure:
+					l = []int{a[1]}
+				case OpVirtualClosure:
+					l = d.methodTargets(d.regType(f, a[1]), a[2])
+				default:
+					continue
+				}
+				if a[0] >= 0 && a[0] < len(f.regIdx) {
+					t := f.regIdx[a[0]]
+					d.closures[t] = append(d.closures[t], l...)
+				}
+			}
+		}
+		for t, l := range d.closures {
+			d.closures[t] = uniqueInts(l)
+		}
+	}
+	return d.closures[typeIdx]
+}
+
+// uniqueInts sorts l and removes duplicates
+func uniqueInts(l []int) []int {
+	sort.Ints(l)
+	n := 0
+	for i, v := range l {
+		if i == 0 || v != l[n-1] {
+			l[n] = v
+			n++
+		}
+	}
+	return l[:n]
+}
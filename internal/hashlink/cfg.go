@@ -0,0 +1,150 @@
+package hashlink
+
+import (
+	"sort"
+)
+
+// Edge links a basic block to another. Exceptional edges lead from
+// a block inside a try region to the handler of the region.
+type Edge struct {
+	Block       int  `json:"block"`
+	Exceptional bool `json:"exceptional,omitempty"`
+}
+
+// Block is a basic block covering instructions Start to End, exclusive
+type Block struct {
+	Index int    `json:"index"`
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+	Succ  []Edge `json:"succ,omitempty"`
+	Pred  []Edge `json:"pred,omitempty"`
+}
+
+// CFG is the control flow graph of a function. Block 0 is the entry.
+type CFG struct {
+	Blocks []Block     `json:"blocks"`
+	Try    []TryRegion `json:"try,omitempty"`
+	block  []int
+}
+
+// BlockOf returns the index of the block holding instruction pc
+func (g *CFG) BlockOf(pc int) int { return g.block[pc] }
+
+// successors returns the instructions control may reach from pc when
+// no exception is raised. Targets outside the function are dropped.
+func successors(code []HilInst, pc int) []int {
+	o := &code[pc]
+	a := o.args()
+	var res []int
+	switch o.op {
+	case OpJTrue, OpJFalse, OpJNull, OpJNotNull:
+		res = []int{pc + 1, jumpTarget(pc, a[1])}
+	case OpJSLt, OpJSGte, OpJSGt, OpJSLte, OpJULt, OpJUGte,
+		OpJNotLt, OpJNotGte, OpJEq, OpJNotEq:
+		res = []int{pc + 1, jumpTarget(pc, a[2])}
+	case OpJAlways:
+		res = []int{jumpTarget(pc, a[0])}
+	case OpSwitch:
+		// Values out of range fall through to the next instruction
+		res = []int{pc + 1}
+		for _, x := range o.extra() {
+			res = append(res, jumpTarget(pc, x))
+		}
+	case OpRet, OpThrow, OpRethrow:
+	default:
+		res = []int{pc + 1}
+	}
+
+	n := 0
+	for _, t := range res {
+		if t >= 0 && t < len(code) {
+			res[n] = t
+			n++
+		}
+	}
+	return res[:n]
+}
+
+// endsBlock reports whether instruction op transfers control
+func endsBlock(op HilOp) bool {
+	switch op {
+	case OpJTrue, OpJFalse, OpJNull, OpJNotNull,
+		OpJSLt, OpJSGte, OpJSGt, OpJSLte, OpJULt, OpJUGte,
+		OpJNotLt, OpJNotGte, OpJEq, OpJNotEq, OpJAlways,
+		OpSwitch, OpRet, OpThrow, OpRethrow, OpTrap, OpEndTrap:
+		return true
+	}
+	return false
+}
+
+// FlowGraph returns the control flow graph of function fn, or nil if
+// fn is not a bytecode function.
+func (d *Data) FlowGraph(fn int) *CFG {
+	f, ok := d.LookupFunction(fn).(*hlFunction)
+	if !ok {
+		return nil
+	}
+	return flowGraph(f)
+}
+
+func flowGraph(f *hlFunction) *CFG {
+	code := f.code()
+	g := &CFG{Try: tryRegions(code), block: make([]int, len(code))}
+	if len(code) == 0 {
+		return g
+	}
+
+	// Blocks start at jump targets, handlers and after any control
+	// transfer. Try regions never share a block with unprotected code
+	// as OpTrap and OpEndTrap end blocks.
+	leader := make([]bool, len(code)+1)
+	leader[0] = true
+	for pc := range code {
+		if !endsBlock(code[pc].op) {
+			continue
+		}
+		leader[pc+1] = true
+		for _, t := range successors(code, pc) {
+			leader[t] = true
+		}
+	}
+	for _, r := range g.Try {
+		leader[r.Handler] = true
+	}
+
+	for pc := range code {
+		if leader[pc] {
+			g.Blocks = append(g.Blocks, Block{Index: len(g.Blocks), Start: pc})
+		}
+		n := len(g.Blocks) - 1
+		g.block[pc] = n
+		g.Blocks[n].End = pc + 1
+	}
+
+	link := func(from, to int, exc bool) {
+		b := &g.Blocks[from]
+		for _, e := range b.Succ {
+			if e.Block == to && e.Exceptional == exc {
+				return
+			}
+		}
+		b.Succ = append(b.Succ, Edge{to, exc})
+		g.Blocks[to].Pred = append(g.Blocks[to].Pred, Edge{from, exc})
+	}
+	for i := range g.Blocks {
+		last := g.Blocks[i].End - 1
+		for _, t := range successors(code, last) {
+			link(i, g.block[t], false)
+		}
+	}
+	for _, r := range g.Try {
+		for _, pc := range r.body {
+			link(g.block[pc], g.block[r.Handler], true)
+		}
+	}
+	for i := range g.Blocks {
+		b := &g.Blocks[i]
+		sort.SliceStable(b.Succ, func(x, y int) bool { return !b.Succ[x].Exceptional && b.Succ[y].Exceptional })
+	}
+	return g
+}
@@ -0,0 +1,86 @@
+package hashlink
+
+import (
+	"strings"
+)
+
+// TypeInfo names a type of the module. Kind is the lower case name of
+// its HdtId without the T suffix, e.g. obj or enum.
+type TypeInfo struct {
+	Index int    `json:"index"`
+	Name  string `json:"name"`
+	Kind  string `json:"kind"`
+}
+
+// Types returns the types of the module in index order
+func (d *Data) Types() []TypeInfo {
+	res := make([]TypeInfo, len(d.types))
+	for i, t := range d.types {
+		kind := strings.ToLower(strings.TrimSuffix(t.Id().String(), "T"))
+		res[i] = TypeInfo{i, d.TypeName(t), kind}
+	}
+	return res
+}
+
+// FieldInfo is a field declared by a class
+type FieldInfo struct {
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	TypeIndex int    `json:"typeIndex"`
+}
+
+// ClassInfo describes a class with the fields and methods it declares.
+// Methods holds the functions of its method table followed by those
+// bound to its fields, such as the static methods of $Class objects.
+type ClassInfo struct {
+	Type      int         `json:"type"`
+	Name      string      `json:"name"`
+	Super     string      `json:"super,omitempty"`
+	SuperType int         `json:"superType,omitempty"`
+	Fields    []FieldInfo `json:"fields,omitempty"`
+	Methods   []FuncRef   `json:"methods,omitempty"`
+}
+
+// Classes returns the classes of the module in type order. Resolve
+// must have been called beforehand.
+func (d *Data) Classes() []ClassInfo {
+	var res []ClassInfo
+	for i, t := range d.types {
+		o, ok := t.(*ObjType)
+		if !ok {
+			continue
+		}
+		c := ClassInfo{Type: i, Name: d.TypeName(o)}
+		if o.superPtr != nil {
+			c.Super = d.TypeName(o.superPtr)
+			c.SuperType = o.superIdx
+		}
+		for _, f := range o.lField {
+			c.Fields = append(c.Fields, FieldInfo{d.strings.String(f.nameIdx), d.TypeName(d.LookupType(f.typeIdx)), f.typeIdx})
+		}
+		seen := make(map[int]bool)
+		add := func(fn int) {
+			if !seen[fn] && d.LookupFunction(fn) != nil {
+				seen[fn] = true
+				c.Methods = append(c.Methods, FuncRef{fn, d.FunctionName(fn)})
+			}
+		}
+		for _, p := range o.lProto {
+			add(p.funcIdx)
+		}
+		for _, b := range o.lBinding {
+			add(b.funcIdx)
+		}
+		res = append(res, c)
+	}
+	return res
+}
+
+// Functions returns the bytecode functions of the module in order
+func (d *Data) Functions() []FuncRef {
+	res := make([]FuncRef, len(d.functions))
+	for i, f := range d.functions {
+		res[i] = FuncRef{f.funcIdx, d.FunctionName(f.funcIdx)}
+	}
+	return res
+}
@@ -0,0 +1,113 @@
+package hashlink
+
+import (
+	"strconv"
+)
+
+// lambda records where an anonymous function is first turned into a
+// closure
+type lambda struct {
+	owner int // creating function
+	pc    int // creating instruction
+	seq   int // 1-based, in the order of creation in owner
+	env   hlType
+}
+
+// lambdaOf returns the creation site of anonymous function fn. A
+// function is anonymous when it is neither a method nor bound to a
+// class field. The creation sites of all functions are found on first
+// use, which decodes the code of every function.
+func (d *Data) lambdaOf(fn int) (lambda, bool) {
+	d.lambdaOnce.Do(d.findLambdas)
+	l, ok := d.lambdas[fn]
+	return l, ok
+}
+
+// findLambdas names anonymous functions after the first closure made
+// of them, in function order. Sites that would make a function its own
+// creator, directly or through other anonymous functions, are skipped.
+func (d *Data) findLambdas() {
+	d.lambdas = make(map[int]lambda)
+	count := make(map[int]int)
+	for _, f := range d.functions {
+		code := f.code()
+		for pc := range code {
+			o := &code[pc]
+			if o.op != OpStaticClosure && o.op != OpInstanceClosure {
+				continue
+			}
+			a := o.args()
+			fn := a[1]
+			if g, ok := d.LookupFunction(fn).(*hlFunction); !ok || g.obj != nil {
+				continue
+			}
+			if _, ok := d.lambdas[fn]; ok || d.createdBy(f.funcIdx, fn) {
+				continue
+			}
+			count[f.funcIdx]++
+			l := lambda{owner: f.funcIdx, pc: pc, seq: count[f.funcIdx]}
+			if o.op == OpInstanceClosure {
+				l.env = d.regType(f, a[2])
+			}
+			d.lambdas[fn] = l
+		}
+	}
+}
+
+// createdBy reports whether fn is, or creates through anonymous
+// functions, function owner
+func (d *Data) createdBy(owner, fn int) bool {
+	for owner != fn {
+		l, ok := d.lambdas[owner]
+		if !ok {
+			return false
+		}
+		owner = l.owner
+	}
+	return true
+}
+
+// lambdaName returns the name of the anonymous function created at l
+func (d *Data) lambdaName(l lambda) string {
+	return d.FunctionName(l.owner) + "$lambda" + strconv.Itoa(l.seq)
+}
+
+// ClosureInfo describes an anonymous function and where it is created
+type ClosureInfo struct {
+	FuncRef
+	Owner FuncRef `json:"owner"`
+	PC    int     `json:"pc"`
+	Env   string  `json:"env,omitempty"`
+}
+
+// Closures returns the anonymous functions of the module, in function
+// order. Env is the type of the captured environment of closures bound
+// to a value.
+func (d *Data) Closures() []ClosureInfo {
+	var res []ClosureInfo
+	for _, f := range d.functions {
+		l, ok := d.lambdaOf(f.funcIdx)
+		if !ok {
+			continue
+		}
+		c := ClosureInfo{
+			FuncRef: FuncRef{f.funcIdx, d.FunctionName(f.funcIdx)},
+			Owner:   FuncRef{l.owner, d.FunctionName(l.owner)},
+			PC:      l.pc,
+		}
+		if l.env != nil {
+			c.Env = d.TypeName(l.env)
+		}
+		res = append(res, c)
+	}
+	return res
+}
+
+// ClosureEnv returns the type name of the environment captured by
+// anonymous function fn, or "" if it captures nothing
+func (d *Data) ClosureEnv(fn int) string {
+	if l, ok := d.lambdaOf(fn); ok && l.env != nil {
+		return d.TypeName(l.env)
+	}
+	return ""
+}
@@ -0,0 +1,399 @@
+package hashlink
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ConstKind is the kind of a constant value
+type ConstKind int
+
+const (
+	ConstInt ConstKind = iota
+	ConstFloat
+	ConstBool
+	ConstString
+	ConstBytes
+)
+
+// Const is a value known without running the code
+type Const struct {
+	Kind  ConstKind
+	Int   int64
+	Float float64
+	Str   string
+}
+
+func (c Const) String() string {
+	switch c.Kind {
+	case ConstInt:
+		return strconv.FormatInt(c.Int, 10)
+	case ConstFloat:
+		return strconv.FormatFloat(c.Float, 'g', -1, 64)
+	case ConstBool:
+		return strconv.FormatBool(c.Int != 0)
+	}
+	return strconv.Quote(c.Str)
+}
+
+// text returns the value as converted to a string by Std.string
+func (c Const) text() string {
+	if c.Kind == ConstString || c.Kind == ConstBytes {
+		return c.Str
+	}
+	return c.String()
+}
+
+// Functions recognized when recovering built strings. Static methods
+// are matched without the leading $ of their class.
+const (
+	stringClass    = "String"
+	stringBytes    = "bytes"
+	stringLength   = "length"
+	stringConcat   = "String.__add__"
+	stdString      = "Std.string"
+	bufferClass    = "StringBuf"
+	bufferAdd      = "StringBuf.add"
+	bufferAddChar  = "StringBuf.addChar"
+	bufferToString = "StringBuf.toString"
+	bufferNew      = "StringBuf.__constructor__"
+)
+
+// ConstProp is a pass finding the values of a function that are
+// constant. Values flow through moves, casts, arithmetic and phis of
+// equal constants. String objects are constant once their bytes are set
+// from a constant string in the block creating them, as the compiler
+// does for literals. Strings built by concatenation, Std.string and
+// StringBuf use within a single block are recovered. Loops are not
+// iterated, so values carried around a loop are never constant.
+type ConstProp struct {
+	Values map[*Value]Const
+}
+
+func (p *ConstProp) Name() string { return "constprop" }
+
+func (p *ConstProp) Run(fn *SSAFunc) error {
+	p.Values = make(map[*Value]Const)
+	d := fn.d
+	bufs := make(map[*Value]*strings.Builder)
+
+	for _, b := range fn.Blocks {
+		for _, phi := range b.Phis {
+			if c, ok := p.phi(phi); ok {
+				p.Values[phi] = c
+			}
+		}
+		for _, v := range b.Instrs {
+			if c, ok := p.eval(d, v, bufs); ok && v.HasResult() {
+				p.Values[v] = p.fit(v, c)
+			}
+			if v.Op == OpSetField && len(v.Args) == 2 {
+				p.setField(d, v)
+			}
+			for i, a := range v.Args {
+				if bufs[a] != nil && (i > 0 || !isBufferCall(d, v)) {
+					delete(bufs, a)
+				}
+			}
+			if v.Op == OpNew && v.TypeName() == bufferClass && usedIn(v, b) {
+				bufs[v] = new(strings.Builder)
+			}
+		}
+	}
+	return nil
+}
+
+// setField follows the initialization of a String object, which is
+// only constant while its bytes are those of a constant string
+func (p *ConstProp) setField(d *Data, v *Value) {
+	obj := v.Args[0]
+	if obj.Kind != ValueInst || obj.Op != OpNew || obj.TypeName() != stringClass {
+		return
+	}
+	switch d.fieldName(obj.typ, v.Aux) {
+	case stringBytes:
+		if c, ok := p.Values[v.Args[1]]; ok && c.Kind == ConstString && obj.Block == v.Block {
+			p.Values[obj] = c
+			return
+		}
+	case stringLength:
+		return
+	}
+	delete(p.Values, obj)
+}
+
+// isBufferCall reports whether v is a call to a StringBuf method
+// that is followed when recovering strings
+func isBufferCall(d *Data, v *Value) bool {
+	switch v.Op {
+	case OpCall0, OpCall1, OpCall2, OpCall3, OpCall4, OpCallN:
+	default:
+		return false
+	}
+	switch strings.TrimPrefix(d.FunctionName(v.Aux), "$") {
+	case bufferAdd, bufferAddChar, bufferToString, bufferNew:
+		return true
+	}
+	return false
+}
+
+// usedIn reports whether all uses of v are in block b
+func usedIn(v *Value, b *SSABlock) bool {
+	for _, u := range v.Uses {
+		if u.Block != b || u.Kind == ValuePhi {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *ConstProp) phi(v *Value) (Const, bool) {
+	var c Const
+	for i, a := range v.Args {
+		ac, ok := p.Values[a]
+		if !ok || (i > 0 && ac != c) {
+			return Const{}, false
+		}
+		c = ac
+	}
+	return c, len(v.Args) > 0
+}
+
+// fit truncates integers and floats to the size of the value type
+func (p *ConstProp) fit(v *Value, c Const) Const {
+	switch v.TypeId() {
+	case UI8T:
+		c.Int &= 0xff
+	case UI16T:
+		c.Int &= 0xffff
+	case I32T:
+		c.Int = int64(int32(c.Int))
+	case F32T:
+		c.Float = float64(float32(c.Float))
+	}
+	return c
+}
+
+func (p *ConstProp) eval(d *Data, v *Value, bufs map[*Value]*strings.Builder) (Const, bool) {
+	args := make([]Const, len(v.Args))
+	known := true
+	for i, a := range v.Args {
+		var ok bool
+		if args[i], ok = p.Values[a]; !ok {
+			known = false
+		}
+	}
+
+	switch v.Op {
+	case OpInt:
+		if v.Aux >= 0 && v.Aux < len(d.ints) {
+			return Const{Kind: ConstInt, Int: int64(d.ints[v.Aux])}, true
+		}
+	case OpFloat:
+		if v.Aux >= 0 && v.Aux < len(d.floats) {
+			return Const{Kind: ConstFloat, Float: d.floats[v.Aux]}, true
+		}
+	case OpBool:
+		return Const{Kind: ConstBool, Int: int64(v.Aux & 1)}, true
+	case OpString:
+		return Const{Kind: ConstString, Str: d.strings.String(v.Aux)}, true
+	case OpBytes:
+		return Const{Kind: ConstBytes, Str: d.pool(OpBytes).String(v.Aux)}, true
+	case OpMov, OpToDyn, OpSafeCast, OpUnsafeCast, OpToVirtual:
+		return args[0], known
+	case OpIncr, OpDecr, OpNeg, OpNot, OpToInt, OpToSFloat, OpToUFloat:
+		if known {
+			return unaryOp(v.Op, args[0])
+		}
+	case OpAdd, OpSub, OpMul, OpSDiv, OpUDiv, OpSMod, OpUMod,
+		OpShl, OpSShr, OpUShr, OpAnd, Opr, OpXor:
+		if known {
+			return binaryOp(v.Op, args[0], args[1], v.TypeId() == I64T)
+		}
+	case OpCall0, OpCall1, OpCall2, OpCall3, OpCall4, OpCallN:
+		return p.call(d, v, args, bufs)
+	}
+	return Const{}, false
+}
+
+func unaryOp(op HilOp, a Const) (Const, bool) {
+	switch {
+	case op == OpNot && a.Kind == ConstBool:
+		return Const{Kind: ConstBool, Int: a.Int ^ 1}, true
+	case op == OpToInt && a.Kind == ConstFloat:
+		return Const{Kind: ConstInt, Int: int64(a.Float)}, true
+	case op == OpToSFloat && a.Kind == ConstInt:
+		return Const{Kind: ConstFloat, Float: float64(a.Int)}, true
+	case op == OpToUFloat && a.Kind == ConstInt:
+		return Const{Kind: ConstFloat, Float: float64(uint32(a.Int))}, true
+	case a.Kind == ConstInt:
+		switch op {
+		case OpIncr:
+			a.Int++
+		case OpDecr:
+			a.Int--
+		case OpNeg:
+			a.Int = -a.Int
+		case OpToInt:
+		default:
+			return Const{}, false
+		}
+		return a, true
+	case a.Kind == ConstFloat && op == OpNeg:
+		a.Float = -a.Float
+		return a, true
+	}
+	return Const{}, false
+}
+
+// binaryOp applies op to a and b. Integers are shifted and divided
+// unsigned as 64 bit values if wide and 32 bit values otherwise.
+func binaryOp(op HilOp, a, b Const, wide bool) (Const, bool) {
+	if a.Kind == ConstFloat && b.Kind == ConstFloat {
+		switch op {
+		case OpAdd:
+			a.Float += b.Float
+		case OpSub:
+			a.Float -= b.Float
+		case OpMul:
+			a.Float *= b.Float
+		case OpSDiv, OpUDiv:
+			a.Float /= b.Float
+		default:
+			return Const{}, false
+		}
+		return a, true
+	}
+	if a.Kind != ConstInt || b.Kind != ConstInt {
+		return Const{}, false
+	}
+	x, y := a.Int, b.Int
+	if wide {
+		switch op {
+		case OpShl:
+			return Const{Kind: ConstInt, Int: x << uint(y&63)}, true
+		case OpSShr:
+			return Const{Kind: ConstInt, Int: x >> uint(y&63)}, true
+		case OpUShr:
+			return Const{Kind: ConstInt, Int: int64(uint64(x) >> uint(y&63))}, true
+		case OpUDiv, OpUMod:
+			if y == 0 {
+				return Const{}, false
+			}
+			if op == OpUDiv {
+				return Const{Kind: ConstInt, Int: int64(uint64(x) / uint64(y))}, true
+			}
+			return Const{Kind: ConstInt, Int: int64(uint64(x) % uint64(y))}, true
+		}
+	}
+	switch op {
+	case OpAdd:
+		x += y
+	case OpSub:
+		x -= y
+	case OpMul:
+		x *= y
+	case OpSDiv, OpSMod, OpUDiv, OpUMod:
+		if y == 0 {
+			return Const{}, false
+		}
+		switch op {
+		case OpSDiv:
+			x /= y
+		case OpSMod:
+			x %= y
+		case OpUDiv:
+			x = int64(uint32(x) / uint32(y))
+		case OpUMod:
+			x = int64(uint32(x) % uint32(y))
+		}
+	case OpShl:
+		x <<= uint(y & 31)
+	case OpSShr:
+		x = int64(int32(x) >> uint(y&31))
+	case OpUShr:
+		x = int64(uint32(x) >> uint(y&31))
+	case OpAnd:
+		x &= y
+	case Opr:
+		x |= y
+	case OpXor:
+		x ^= y
+	}
+	return Const{Kind: ConstInt, Int: x}, true
+}
+
+// call recovers the strings built by the known string functions
+func (p *ConstProp) call(d *Data, v *Value, args []Const, bufs map[*Value]*strings.Builder) (Const, bool) {
+	name := strings.TrimPrefix(d.FunctionName(v.Aux), "$")
+	known := func(i int) bool {
+		if i >= len(v.Args) {
+			return false
+		}
+		_, ok := p.Values[v.Args[i]]
+		return ok
+	}
+
+	switch name {
+	case stringConcat:
+		if known(0) && known(1) {
+			return Const{Kind: ConstString, Str: args[0].text() + args[1].text()}, true
+		}
+	case stdString:
+		if known(0) {
+			return Const{Kind: ConstString, Str: args[0].text()}, true
+		}
+	case bufferAdd, bufferAddChar, bufferToString:
+		if len(v.Args) == 0 {
+			break
+		}
+		buf := bufs[v.Args[0]]
+		if buf == nil {
+			break
+		}
+		switch {
+		case name == bufferToString:
+			return Const{Kind: ConstString, Str: buf.String()}, true
+		case !known(1):
+			delete(bufs, v.Args[0])
+		case name == bufferAdd:
+			buf.WriteString(args[1].text())
+		default:
+			buf.WriteRune(rune(args[1].Int))
+		}
+	}
+	return Const{}, false
+}
+
+// constNotes describes the constant arguments of each call of f,
+// and the string a call builds, by instruction.
+func (d *Data) constNotes(f *hlFunction, an *Analysis) map[int]string {
+	fn := d.buildSSA(f, an)
+	var cp ConstProp
+	cp.Run(fn)
+
+	notes := make(map[int]string)
+	for _, b := range fn.Blocks {
+		for _, v := range b.Instrs {
+			switch v.Op {
+			case OpCall0, OpCall1, OpCall2, OpCall3, OpCall4, OpCallN,
+				OpCallMethod, OpCallThis, OpCallClosure:
+			default:
+				continue
+			}
+			var l []string
+			for _, a := range v.Args {
+				if c, ok := cp.Values[a]; ok {
+					l = append(l, d.regName(f, a.Reg)+" = "+c.String())
+				}
+			}
+			if c, ok := cp.Values[v]; ok {
+				l = append(l, "-> "+c.String())
+			}
+			if len(l) > 0 {
+				notes[v.PC] = strings.Join(l, ", ")
+			}
+		}
+	}
+	return notes
+}
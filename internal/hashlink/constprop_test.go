@@ -0,0 +1,120 @@
+package hashlink
+
+import "testing"
+
+// stringModule encodes code shaped as emitted by the Haxe compiler for
+// "foo" + "bar" in function 0, and 1 << 40 on 64 bit integers in
+// function 2. Function 1 is String.__add__.
+func stringModule() []byte {
+	var w hlbWriter
+	w.WriteString(Magic)
+	w.WriteByte(4)
+	w.index(0) // flags
+	w.index(3) // ints
+	w.index(0) // floats
+	w.index(7) // strings
+	w.index(9) // types
+	w.index(0) // globals
+	w.index(0) // natives
+	w.index(3) // functions
+	w.index(0) // constants
+	w.index(0) // entry point
+
+	for _, v := range []int32{3, 1, 40} {
+		w.int32(v)
+	}
+	var strs [][]byte
+	for _, s := range []string{"String", "bytes", "length", "$String", "__add__", "foo", "bar"} {
+		strs = append(strs, []byte(s))
+	}
+	w.stringBlock(strs)
+
+	w.WriteByte(byte(VoidT))  // 0
+	w.WriteByte(byte(I32T))   // 1
+	w.WriteByte(byte(I64T))   // 2
+	w.WriteByte(byte(BytesT)) // 3
+	w.WriteByte(byte(ObjT))   // 4 String
+	for _, v := range []int{0, -1, 0, 2, 0, 0, 1, 3, 2, 1} {
+		w.index(v)
+	}
+	w.WriteByte(byte(ObjT)) // 5 $String
+	for _, v := range []int{3, -1, 0, 0, 1, 0, 4, 1, -1} {
+		w.index(v)
+	}
+	for _, f := range [][]int{{4, 4, 4}, {4}, {2}} { // 6, 7, 8
+		w.WriteByte(byte(FunT))
+		w.WriteByte(byte(len(f) - 1))
+		for _, t := range f {
+			w.index(t)
+		}
+	}
+
+	fn := func(typ, idx int, regs []int, code [][]int) {
+		w.index(typ)
+		w.index(idx)
+		w.index(len(regs))
+		w.index(len(code))
+		for _, r := range regs {
+			w.index(r)
+		}
+		for _, op := range code {
+			w.WriteByte(byte(op[0]))
+			for _, v := range op[1:] {
+				w.index(v)
+			}
+		}
+	}
+	fn(7, 0, []int{4, 3, 1, 4, 3, 4}, [][]int{
+		{int(OpNew), 0},
+		{int(OpString), 1, 5},
+		{int(OpSetField), 0, 0, 1},
+		{int(OpInt), 2, 0},
+		{int(OpSetField), 0, 1, 2},
+		{int(OpNew), 3},
+		{int(OpString), 4, 6},
+		{int(OpSetField), 3, 0, 4},
+		{int(OpSetField), 3, 1, 2},
+		{int(OpCall2), 5, 1, 0, 3},
+		{int(OpRet), 5},
+	})
+	fn(6, 1, []int{4, 4}, [][]int{{int(OpRet), 0}})
+	fn(8, 2, []int{2, 2, 2}, [][]int{
+		{int(OpInt), 0, 1},
+		{int(OpInt), 1, 2},
+		{int(OpShl), 2, 0, 1},
+		{int(OpRet), 2},
+	})
+	return w.Bytes()
+}
+
+// returned runs constant propagation over function fn and returns the
+// value returned by its last instruction
+func returned(t *testing.T, d *Data, fn int) (Const, bool) {
+	ssa := d.SSA(fn)
+	var cp ConstProp
+	if err := cp.Run(ssa); err != nil {
+		t.Fatal(err)
+	}
+	b := ssa.Blocks[len(ssa.Blocks)-1]
+	ret := b.Instrs[len(b.Instrs)-1]
+	c, ok := cp.Values[ret.Args[0]]
+	return c, ok
+}
+
+func TestConstProp(t *testing.T) {
+	d, err := NewData(stringModule())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Resolve()
+	if name := d.FunctionName(1); name != "$String.__add__" {
+		t.Fatalf("function 1 named %q", name)
+	}
+
+	if c, ok := returned(t, d, 0); !ok || c.Kind != ConstString || c.Str != "foobar" {
+		t.Errorf("concatenation returns %v, %v", c, ok)
+	}
+	if c, ok := returned(t, d, 2); !ok || c.Int != 1<<40 {
+		t.Errorf("64 bit shift returns %v, %v", c, ok)
+	}
+}
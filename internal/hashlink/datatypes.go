@@ -25,4 +25,7 @@ const (
 	AbstractT
 	EnumT
 	NullT
+	MethodT
+	StructT
+	PackedT
 )
@@ -0,0 +1,122 @@
+package hashlink
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestTruncated(t *testing.T) {
+	buf := syntheticModule(4, 20)
+	for n := 0; n < len(buf); n++ {
+		if _, err := NewData(buf[:n]); err == nil {
+			t.Fatalf("NewData of %d bytes: no error", n)
+		}
+		if _, err := Parse(bytes.NewReader(buf[:n])); err == nil {
+			t.Fatalf("Parse of %d bytes: no error", n)
+		}
+	}
+}
+
+// funcModule encodes a module of functions of type () -> void with the
+// given indexes, preceded by a table of types sized nTypes
+func funcModule(nTypes int, idx ...int) []byte {
+	var w hlbWriter
+	w.WriteString(Magic)
+	w.WriteByte(4)
+	w.index(0)      // flags
+	w.index(0)      // ints
+	w.index(0)      // floats
+	w.index(0)      // strings
+	w.index(nTypes) // types
+	w.index(0)      // globals
+	w.index(0)      // natives
+	w.index(len(idx))
+	w.index(0) // constants
+	w.index(0) // entry point
+
+	w.stringBlock(nil)
+	w.WriteByte(byte(VoidT))
+	w.WriteByte(byte(FunT))
+	w.WriteByte(0)
+	w.index(0)
+	for _, i := range idx {
+		w.index(1)
+		w.index(i)
+		w.index(1)
+		w.index(1)
+		w.index(0)
+		w.WriteByte(byte(OpRet))
+		w.index(0)
+	}
+	return w.Bytes()
+}
+
+func TestCorrupt(t *testing.T) {
+	if _, err := NewData(funcModule(2, 0, 1)); err != nil {
+		t.Fatal(err)
+	}
+	for name, buf := range map[string][]byte{
+		"huge count":            funcModule(0x1fffffff),
+		"duplicate function":    funcModule(2, 0, 0),
+		"function out of range": funcModule(2, 0, 2),
+	} {
+		if _, err := NewData(buf); err != ErrCorrupt {
+			t.Errorf("NewData of %s: %v", name, err)
+		}
+		if _, err := Parse(bytes.NewReader(buf)); err != ErrCorrupt {
+			t.Errorf("Parse of %s: %v", name, err)
+		}
+	}
+}
+
+// listings returns the listing of every function of the module in buf
+// decoded as directed by opt
+func listings(t *testing.T, buf []byte, opt *Options) [][]Line {
+	d, err := NewDataOptions(buf, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Resolve()
+	res := make([][]Line, len(d.functions))
+	for i, f := range d.functions {
+		res[i] = d.Listing(f.funcIdx)
+	}
+	return res
+}
+
+func TestWorkers(t *testing.T) {
+	buf := syntheticModule(200, 50)
+	want := listings(t, buf, &Options{Workers: 1})
+	if len(want[0]) == 0 {
+		t.Fatal("empty listing")
+	}
+	for _, opt := range []*Options{{Workers: 8}, {LazyCode: true}} {
+		got := listings(t, buf, opt)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("listings with %+v differ from serial decoding", *opt)
+		}
+	}
+}
+
+func TestClose(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "v5.hl")
+	if err := os.WriteFile(name, v5Module(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	d, err := Open(name, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if s := d.strings.String(0); s != "Point" {
+		t.Errorf("string 0 is %q after Close", s)
+	}
+	if b := d.bytes.Bytes(0); string(b) != "\x90\xc3" {
+		t.Errorf("bytes 0 are %q after Close", b)
+	}
+}
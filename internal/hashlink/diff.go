@@ -0,0 +1,328 @@
+package hashlink
+
+import (
+	"sort"
+	"strconv"
+)
+
+// Kinds of module difference
+const (
+	DiffAdded   = "added"
+	DiffRemoved = "removed"
+	DiffChanged = "changed"
+)
+
+// DiffEntry is a single semantic difference between two modules.
+// Kind is one of class, field, method, closure, native, string or
+// function.
+// Lines holds an instruction level diff for changed functions with
+// each line prefixed by "+", "-" or " ".
+type DiffEntry struct {
+	Kind   string   `json:"kind"`
+	Name   string   `json:"name"`
+	Change string   `json:"change"`
+	Old    string   `json:"old,omitempty"`
+	New    string   `json:"new,omitempty"`
+	Lines  []string `json:"lines,omitempty"`
+}
+
+// Lines of unchanged context kept around each instruction hunk
+const diffContext = 2
+
+// moduleKeys indexes the parts of a module by keys that are stable
+// across builds, ie. names rather than table indexes.
+type moduleKeys struct {
+	classes   map[string]*ObjType
+	fields    map[string]string
+	methods   map[string]string
+	closures  map[string]string
+	natives   map[string]string
+	strings   map[string]bool
+	functions map[string]*hlFunction
+}
+
+func (d *Data) moduleKeys() *moduleKeys {
+	k := &moduleKeys{
+		classes:   make(map[string]*ObjType),
+		fields:    make(map[string]string),
+		methods:   make(map[string]string),
+		closures:  make(map[string]string),
+		natives:   make(map[string]string),
+		strings:   make(map[string]bool),
+		functions: make(map[string]*hlFunction),
+	}
+
+	for _, t := range d.types {
+		t, ok := t.(*ObjType)
+		if !ok {
+			continue
+		}
+		name := d.strings.String(t.nameIdx)
+		k.classes[name] = t
+		for i := range t.lField {
+			k.fields[name+"."+d.strings.String(t.lField[i].nameIdx)] = d.TypeName(d.LookupType(t.lField[i].typeIdx))
+		}
+	}
+
+	// Anonymous functions are paired by the name of their creator
+	for _, f := range d.functions {
+		name := d.FunctionName(f.funcIdx)
+		sig := d.TypeName(d.LookupType(f.typeIdx))
+		if f.obj != nil {
+			k.methods[name] = sig
+		} else if _, ok := d.lambdaOf(f.funcIdx); ok {
+			k.closures[name] = sig
+		} else {
+			continue
+		}
+		k.functions[name] = f
+	}
+
+	for _, n := range d.natives {
+		k.natives[n.libPtr+"."+n.namePtr] = d.TypeName(d.LookupType(n.typeIdx))
+	}
+
+	for i := range d.strings.index {
+		k.strings[d.strings.String(i)] = true
+	}
+
+	return k
+}
+
+// Diff compares two resolved modules and returns their differences.
+// Entries are sorted by kind and name.
+func Diff(a, b *Data) []DiffEntry {
+	ka, kb := a.moduleKeys(), b.moduleKeys()
+	var res []DiffEntry
+
+	for name := range ka.classes {
+		if _, ok := kb.classes[name]; !ok {
+			res = append(res, DiffEntry{Kind: "class", Name: name, Change: DiffRemoved})
+		}
+	}
+	for name := range kb.classes {
+		if _, ok := ka.classes[name]; !ok {
+			res = append(res, DiffEntry{Kind: "class", Name: name, Change: DiffAdded})
+		}
+	}
+	for name, ca := range ka.classes {
+		cb, ok := kb.classes[name]
+		if !ok {
+			continue
+		}
+		sa, sb := a.superName(ca), b.superName(cb)
+		if sa != sb {
+			res = append(res, DiffEntry{Kind: "class", Name: name, Change: DiffChanged, Old: "extends " + sa, New: "extends " + sb})
+		}
+	}
+
+	res = append(res, diffMaps("field", ka.fields, kb.fields)...)
+	res = append(res, diffMaps("method", ka.methods, kb.methods)...)
+	res = append(res, diffMaps("closure", ka.closures, kb.closures)...)
+	res = append(res, diffMaps("native", ka.natives, kb.natives)...)
+
+	for s := range ka.strings {
+		if !kb.strings[s] {
+			res = append(res, DiffEntry{Kind: "string", Name: strconv.Quote(s), Change: DiffRemoved})
+		}
+	}
+	for s := range kb.strings {
+		if !ka.strings[s] {
+			res = append(res, DiffEntry{Kind: "string", Name: strconv.Quote(s), Change: DiffAdded})
+		}
+	}
+
+	for name, fa := range ka.functions {
+		fb, ok := kb.functions[name]
+		if !ok {
+			continue
+		}
+		la, lb := a.listing(fa), b.listing(fb)
+		if equalLines(la, lb) {
+			continue
+		}
+		res = append(res, DiffEntry{
+			Kind:   "function",
+			Name:   name,
+			Change: DiffChanged,
+			Old:    strconv.Itoa(len(la)) + " instructions",
+			New:    strconv.Itoa(len(lb)) + " instructions",
+			Lines:  hunks(diffLines(la, lb), diffContext),
+		})
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Kind != res[j].Kind {
+			return res[i].Kind < res[j].Kind
+		}
+		return res[i].Name < res[j].Name
+	})
+	return res
+}
+
+func (d *Data) superName(t *ObjType) string {
+	if t.superPtr == nil {
+		return ""
+	}
+	return d.strings.String(t.superPtr.nameIdx)
+}
+
+// listing returns the instructions of f formatted for comparison
+func (d *Data) listing(f *hlFunction) []string {
+	res := make([]string, len(f.code()))
+	for i := range res {
+		res[i] = d.formatInst(f, i, fmtRelative, noLink)
+	}
+	return res
+}
+
+func diffMaps(kind string, a, b map[string]string) []DiffEntry {
+	var res []DiffEntry
+	for name, va := range a {
+		vb, ok := b[name]
+		switch {
+		case !ok:
+			res = append(res, DiffEntry{Kind: kind, Name: name, Change: DiffRemoved, Old: va})
+		case va != vb:
+			res = append(res, DiffEntry{Kind: kind, Name: name, Change: DiffChanged, Old: va, New: vb})
+		}
+	}
+	for name, vb := range b {
+		if _, ok := a[name]; !ok {
+			res = append(res, DiffEntry{Kind: kind, Name: name, Change: DiffAdded, New: vb})
+		}
+	}
+	return res
+}
+
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// lineEdit is a single line of an edit script
+type lineEdit struct {
+	op   byte // ' ', '-' or '+'
+	text string
+}
+
+// diffLines computes a shortest edit script from a to b using
+// Myers' O(ND) algorithm.
+func diffLines(a, b []string) []lineEdit {
+	n, m := len(a), len(b)
+	max := n + m
+	v := make([]int, 2*max+2)
+	var trace []diffRound
+
+	for d := 0; d <= max; d++ {
+		// Only the diagonals reachable from the previous round are kept
+		lo, hi := max-d-1, max+d+2
+		if lo < 0 {
+			lo = 0
+		}
+		if hi > len(v) {
+			hi = len(v)
+		}
+		trace = append(trace, diffRound{lo, append([]int(nil), v[lo:hi]...)})
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[max+k-1] < v[max+k+1]) {
+				x = v[max+k+1]
+			} else {
+				x = v[max+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[max+k] = x
+			if x >= n && y >= m {
+				return backtrack(a, b, trace, max)
+			}
+		}
+	}
+	return nil
+}
+
+// diffRound holds the furthest reaching x of each diagonal at the
+// start of a round, stored from diagonal index lo.
+type diffRound struct {
+	lo int
+	v  []int
+}
+
+func (r *diffRound) x(i int) int { return r.v[i-r.lo] }
+
+func backtrack(a, b []string, trace []diffRound, max int) []lineEdit {
+	var res []lineEdit
+	x, y := len(a), len(b)
+	for d := len(trace) - 1; d >= 0; d-- {
+		r := &trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && r.x(max+k-1) < r.x(max+k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := r.x(max + prevK)
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			res = append(res, lineEdit{' ', a[x-1]})
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == prevX {
+				res = append(res, lineEdit{'+', b[y-1]})
+			} else {
+				res = append(res, lineEdit{'-', a[x-1]})
+			}
+		}
+		x, y = prevX, prevY
+	}
+	for i, j := 0, len(res)-1; i < j; i, j = i+1, j-1 {
+		res[i], res[j] = res[j], res[i]
+	}
+	return res
+}
+
+// hunks renders an edit script keeping ctx lines of context around
+// changes. Skipped regions are marked with a "..." line.
+func hunks(edits []lineEdit, ctx int) []string {
+	keep := make([]bool, len(edits))
+	for i := range edits {
+		if edits[i].op == ' ' {
+			continue
+		}
+		for j := i - ctx; j <= i+ctx; j++ {
+			if j >= 0 && j < len(edits) {
+				keep[j] = true
+			}
+		}
+	}
+
+	var res []string
+	skipped := false
+	for i := range edits {
+		if !keep[i] {
+			skipped = true
+			continue
+		}
+		if skipped && len(res) > 0 {
+			res = append(res, "...")
+		}
+		skipped = false
+		res = append(res, string(edits[i].op)+" "+edits[i].text)
+	}
+	return res
+}
@@ -0,0 +1,287 @@
+package hashlink
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// regType returns the declared type of register r in f
+func (d *Data) regType(f *hlFunction, r int) hlType {
+	if r < 0 || r >= len(f.regIdx) {
+		return nil
+	}
+	return d.LookupType(f.regIdx[r])
+}
+
+// fieldName returns the name of field i of an object or virtual
+func (d *Data) fieldName(t hlType, i int) string {
+	switch t := t.(type) {
+	case *ObjType:
+		if fld := t.field(i); fld != nil {
+			return d.strings.String(fld.nameIdx)
+		}
+	case *VirtualType:
+		if i >= 0 && i < len(t.field) {
+			return d.strings.String(t.field[i].nameIdx)
+		}
+	}
+	return "#" + strconv.Itoa(i)
+}
+
+// proto returns the method bound to virtual table slot pindex,
+// searching from t towards the root of the class hierarchy.
+func (t *ObjType) proto(pindex int) *hlProto {
+	for o := t; o != nil; o = o.superPtr {
+		for i := range o.lProto {
+			if o.lProto[i].override == pindex {
+				return &o.lProto[i]
+			}
+		}
+	}
+	return nil
+}
+
+// hasProto reports whether t or one of its super classes has a method
+// named by string nameIdx
+func (t *ObjType) hasProto(nameIdx int) bool {
+	for o := t; o != nil; o = o.superPtr {
+		for i := range o.lProto {
+			if o.lProto[i].nameIdx == nameIdx {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// methodName returns the name of method slot i of an object or virtual
+func (d *Data) methodName(t hlType, i int) string {
+	if o, ok := t.(*ObjType); ok {
+		if p := o.proto(i); p != nil {
+			return d.strings.String(p.nameIdx)
+		}
+		return "#" + strconv.Itoa(i)
+	}
+	return d.fieldName(t, i)
+}
+
+// globalName returns a name for global g that does not depend on
+// its index, using the class or enum it backs when available.
+func (d *Data) globalName(g int) string {
+	if g < 0 || g >= len(d.globals) {
+		return "global@" + strconv.Itoa(g)
+	}
+	if s := d.symbols.global(g); s != nil && s.Name != "" {
+		return s.Name
+	}
+	if t := d.globalOwner[g]; t != nil {
+		return d.TypeName(d.globals[g])
+	}
+	return "global@" + strconv.Itoa(g)
+}
+
+// enumConstruct returns the name of constructor c of the enum in register r
+func (d *Data) enumConstruct(f *hlFunction, r, c int) string {
+	if t, ok := d.regType(f, r).(*EnumType); ok && c >= 0 && c < len(t.lConstruct) {
+		return d.strings.String(t.nameIdx) + "." + d.strings.String(t.lConstruct[c].nameIdx)
+	}
+	return "#" + strconv.Itoa(c)
+}
+
+// regName returns the symbol name of register r in f, or rN
+func (d *Data) regName(f *hlFunction, r int) string {
+	if s := d.symbols.register(f.funcIdx, r); s != nil && s.Name != "" {
+		return s.Name
+	}
+	return "r" + strconv.Itoa(r)
+}
+
+// jumpTarget returns the instruction index reached by a jump at pc
+func jumpTarget(pc, offset int) int {
+	return pc + 1 + offset
+}
+
+// Instruction formatting options
+type instFormat int
+
+const (
+	// Jump targets are printed as raw offsets rather than absolute
+	// instruction indexes so that unrelated code insertions do not
+	// alter the text.
+	fmtRelative instFormat = 1 << iota
+
+	// Registers are annotated with their declared type
+	fmtTyped
+)
+
+// EntityKind is the kind of module entity named by an operand
+type EntityKind int
+
+const (
+	EntityNone EntityKind = iota // text naming no entity, such as a register
+	EntityType
+	EntityFunction
+	EntityGlobal
+	EntityString
+	EntityBytes
+)
+
+// Entity identifies the module entity named by an operand
+type Entity struct {
+	Kind  EntityKind
+	Index int
+}
+
+// LinkFunc returns the text of an operand naming e as it should
+// appear in formatted instructions, e.g. wrapped in a hyperlink.
+// All text taken from the module or a symbol map is passed through
+// it, the rest of the instruction is plain ASCII.
+type LinkFunc func(e Entity, text string) string
+
+// noLink formats operands as is
+func noLink(e Entity, text string) string { return text }
+
+// instString formats instruction pc of function f. Indexes into the
+// constant pools, types, globals and functions are resolved to values
+// so the result stays meaningful across rebuilds of a module.
+func (d *Data) instString(f *hlFunction, pc int) string {
+	return d.formatInst(f, pc, fmtTyped, noLink)
+}
+
+// formatInst formats instruction pc of function f, passing the
+// operands naming entities through link
+func (d *Data) formatInst(f *hlFunction, pc int, format instFormat, link LinkFunc) string {
+	o := &f.code()[pc]
+	name := OpCodes[o.op].name
+	a, x := o.args(), o.extra()
+	none := func(s string) string { return link(Entity{EntityNone, 0}, s) }
+	typ := func(t int) string {
+		if t < 0 || t >= len(d.types) {
+			return none("?")
+		}
+		return link(Entity{EntityType, t}, d.TypeName(d.types[t]))
+	}
+	regTyp := func(r int) string {
+		if r < 0 || r >= len(f.regIdx) {
+			return none("?")
+		}
+		return typ(f.regIdx[r])
+	}
+	fun := func(i int) string { return link(Entity{EntityFunction, i}, d.FunctionName(i)) }
+	global := func(g int) string { return link(Entity{EntityGlobal, g}, d.globalName(g)) }
+	reg := func(r int) string {
+		if format&fmtTyped != 0 {
+			return none(d.regName(f, r)) + ":" + regTyp(r)
+		}
+		return none(d.regName(f, r))
+	}
+	regs := func(l []int) string {
+		s := make([]string, len(l))
+		for i := range l {
+			s[i] = reg(l[i])
+		}
+		return strings.Join(s, ", ")
+	}
+	target := func(offset int) string {
+		if format&fmtRelative != 0 {
+			return fmt.Sprintf("%+d", offset)
+		}
+		return "@" + strconv.Itoa(jumpTarget(pc, offset))
+	}
+
+	switch o.op {
+	case OpInt:
+		v := "?"
+		if a[1] >= 0 && a[1] < len(d.ints) {
+			v = strconv.Itoa(d.ints[a[1]])
+		}
+		return fmt.Sprintf("%s %s, %s", name, reg(a[0]), v)
+	case OpFloat:
+		v := "?"
+		if a[1] >= 0 && a[1] < len(d.floats) {
+			v = strconv.FormatFloat(d.floats[a[1]], 'g', -1, 64)
+		}
+		return fmt.Sprintf("%s %s, %s", name, reg(a[0]), v)
+	case OpBool:
+		return fmt.Sprintf("%s %s, %t", name, reg(a[0]), a[1] != 0)
+	case OpString, OpBytes:
+		kind := EntityString
+		if o.op == OpBytes {
+			kind = EntityBytes
+		}
+		return fmt.Sprintf("%s %s, %s", name, reg(a[0]), link(Entity{kind, a[1]}, strconv.Quote(d.pool(o.op).String(a[1]))))
+	case OpCall0, OpCall1, OpCall2, OpCall3, OpCall4:
+		return fmt.Sprintf("%s %s, %s(%s)", name, reg(a[0]), fun(a[1]), regs(a[2:]))
+	case OpCallN:
+		return fmt.Sprintf("%s %s, %s(%s)", name, reg(a[0]), fun(a[1]), regs(x))
+	case OpCallMethod:
+		if len(x) == 0 {
+			break
+		}
+		return fmt.Sprintf("%s %s, %s.%s(%s)", name, reg(a[0]), reg(x[0]), none(d.methodName(d.regType(f, x[0]), a[1])), regs(x[1:]))
+	case OpCallThis:
+		return fmt.Sprintf("%s %s, this.%s(%s)", name, reg(a[0]), none(d.methodName(d.regType(f, 0), a[1])), regs(x))
+	case OpCallClosure:
+		return fmt.Sprintf("%s %s, %s(%s)", name, reg(a[0]), reg(a[1]), regs(x))
+	case OpStaticClosure:
+		return fmt.Sprintf("%s %s, %s", name, reg(a[0]), fun(a[1]))
+	case OpInstanceClosure:
+		return fmt.Sprintf("%s %s, %s, %s", name, reg(a[0]), fun(a[1]), reg(a[2]))
+	case OpVirtualClosure:
+		return fmt.Sprintf("%s %s, %s.%s", name, reg(a[0]), reg(a[1]), none(d.methodName(d.regType(f, a[1]), a[2])))
+	case OpGetGlobal:
+		return fmt.Sprintf("%s %s, %s", name, reg(a[0]), global(a[1]))
+	case OpSetGlobal:
+		return fmt.Sprintf("%s %s, %s", name, global(a[0]), reg(a[1]))
+	case OpField:
+		return fmt.Sprintf("%s %s, %s.%s", name, reg(a[0]), reg(a[1]), none(d.fieldName(d.regType(f, a[1]), a[2])))
+	case OpSetField:
+		return fmt.Sprintf("%s %s.%s, %s", name, reg(a[0]), none(d.fieldName(d.regType(f, a[0]), a[1])), reg(a[2]))
+	case OpGetThis:
+		return fmt.Sprintf("%s %s, this.%s", name, reg(a[0]), none(d.fieldName(d.regType(f, 0), a[1])))
+	case OpSetThis:
+		return fmt.Sprintf("%s this.%s, %s", name, none(d.fieldName(d.regType(f, 0), a[0])), reg(a[1]))
+	case OpDynGet:
+		return fmt.Sprintf("%s %s, %s.%s", name, reg(a[0]), reg(a[1]), none(d.strings.String(a[2])))
+	case OpDynSet:
+		return fmt.Sprintf("%s %s.%s, %s", name, reg(a[0]), none(d.strings.String(a[1])), reg(a[2]))
+	case OpJTrue, OpJFalse, OpJNull, OpJNotNull:
+		return fmt.Sprintf("%s %s, %s", name, reg(a[0]), target(a[1]))
+	case OpJSLt, OpJSGte, OpJSGt, OpJSLte, OpJULt, OpJUGte,
+		OpJNotLt, OpJNotGte, OpJEq, OpJNotEq:
+		return fmt.Sprintf("%s %s, %s, %s", name, reg(a[0]), reg(a[1]), target(a[2]))
+	case OpJAlways:
+		return fmt.Sprintf("%s %s", name, target(a[0]))
+	case OpSwitch:
+		tgt := make([]string, len(x))
+		for i := range x {
+			tgt[i] = target(x[i])
+		}
+		return fmt.Sprintf("%s %s, [%s], %s", name, reg(a[0]), strings.Join(tgt, ", "), target(a[2]))
+	case OpTrap:
+		return fmt.Sprintf("%s %s, %s", name, reg(a[0]), target(a[1]))
+	case OpEndTrap:
+		return fmt.Sprintf("%s %d", name, a[0])
+	case OpType:
+		return fmt.Sprintf("%s %s, %s", name, reg(a[0]), typ(a[1]))
+	case OpNew:
+		if format&fmtTyped != 0 {
+			break
+		}
+		return fmt.Sprintf("%s %s ; %s", name, reg(a[0]), regTyp(a[0]))
+	case OpMakeEnum:
+		return fmt.Sprintf("%s %s, %s(%s)", name, reg(a[0]), none(d.enumConstruct(f, a[0], a[1])), regs(x))
+	case OpEnumAlloc:
+		return fmt.Sprintf("%s %s, %s", name, reg(a[0]), none(d.enumConstruct(f, a[0], a[1])))
+	case OpEnumField:
+		return fmt.Sprintf("%s %s, %s, %s, %d", name, reg(a[0]), reg(a[1]), none(d.enumConstruct(f, a[1], a[2])), a[3])
+	case OpSetEnumField:
+		return fmt.Sprintf("%s %s.%d, %s", name, reg(a[0]), a[1], reg(a[2]))
+	}
+
+	if len(a) == 0 {
+		return name
+	}
+	return name + " " + regs(a)
+}
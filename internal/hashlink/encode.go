@@ -0,0 +1,297 @@
+package hashlink
+
+import (
+	"io"
+)
+
+// Encode writes d in the HLB format. Functions for which keep returns
+// false are left out, as are class bindings to them, and the remaining
+// functions and natives are renumbered in index order. The removed
+// functions must not be referenced by the code that is kept or by any
+// method table. A nil keep writes every function.
+func (d *Data) Encode(w io.Writer, keep func(fn int) bool) error {
+	if keep == nil {
+		keep = func(int) bool { return true }
+	}
+
+	// New function indexes
+	remap := make([]int, len(d.funcLookup))
+	n := 0
+	for i := range remap {
+		remap[i] = -1
+		if _, native := d.LookupFunction(i).(*hlNative); native || keep(i) {
+			remap[i] = n
+			n++
+		}
+	}
+	fn := func(i int) int {
+		if i < 0 || i >= len(remap) {
+			return i
+		}
+		return remap[i]
+	}
+	var functions []*hlFunction
+	for _, f := range d.functions {
+		if fn(f.funcIdx) >= 0 {
+			functions = append(functions, f)
+		}
+	}
+
+	typeIdx := make(map[hlType]int, len(d.types))
+	for i, t := range d.types {
+		typeIdx[t] = i
+	}
+
+	var b hlbWriter
+	b.WriteString(Magic)
+	b.WriteByte(byte(d.version))
+	b.index(int(d.flags))
+	b.index(len(d.ints))
+	b.index(len(d.floats))
+	b.index(d.strings.Len())
+	if d.version >= 5 {
+		b.index(d.bytes.Len())
+	}
+	b.index(len(d.types))
+	b.index(len(d.globals))
+	b.index(len(d.natives))
+	b.index(len(functions))
+	if d.version >= 4 {
+		b.index(len(d.constants))
+	}
+	b.index(fn(d.entryPoint))
+
+	for _, v := range d.ints {
+		b.int32(int32(v))
+	}
+	for _, v := range d.floats {
+		b.float64(v)
+	}
+	b.stringBlock(d.strings.index)
+	if d.version >= 5 {
+		b.int32(int32(len(d.bytes.data)))
+		b.Write(d.bytes.data)
+		for _, e := range d.bytes.index {
+			pos := 0
+			if e != nil {
+				pos = cap(d.bytes.data) - cap(e)
+			}
+			b.index(pos)
+		}
+	}
+	if d.flags.HasDebug() {
+		files := make([][]byte, len(d.debugFiles))
+		for i := range d.debugFiles {
+			files[i] = []byte(d.debugFiles[i])
+		}
+		b.index(len(files))
+		b.stringBlock(files)
+	}
+
+	for _, t := range d.types {
+		b.typ(t, fn)
+	}
+	for _, t := range d.globals {
+		b.index(typeIdx[t])
+	}
+	for _, n := range d.natives {
+		b.index(n.libIdx)
+		b.index(n.nameIdx)
+		b.index(n.typeIdx)
+		b.index(fn(n.funcIdx))
+	}
+
+	for _, f := range functions {
+		code := f.code()
+		b.index(f.typeIdx)
+		b.index(fn(f.funcIdx))
+		b.index(len(f.regIdx))
+		b.index(len(code))
+		for _, r := range f.regIdx {
+			b.index(r)
+		}
+		for i := range code {
+			b.instruction(&code[i], fn)
+		}
+		if d.flags.HasDebug() {
+			b.debugInfo(f.positions(), len(code))
+			if d.version >= 3 {
+				b.index(len(f.assigns))
+				for _, a := range f.assigns {
+					b.index(a.nameIdx)
+					b.index(a.pos)
+				}
+			}
+		}
+	}
+
+	for _, c := range d.constants {
+		b.index(c.globalIdx)
+		b.index(len(c.fields))
+		for _, v := range c.fields {
+			b.index(v)
+		}
+	}
+
+	_, err := b.WriteTo(w)
+	return err
+}
+
+// stringBlock writes a string table: the size of the NUL separated
+// blob, the blob and the size of each string.
+func (w *hlbWriter) stringBlock(l [][]byte) {
+	size := 0
+	for _, s := range l {
+		size += len(s) + 1
+	}
+	w.int32(int32(size))
+	for _, s := range l {
+		w.Write(s)
+		w.WriteByte(0)
+	}
+	for _, s := range l {
+		w.index(len(s))
+	}
+}
+
+// typ writes the definition of t, mapping function indexes with fn.
+// Bindings to functions removed by fn are dropped.
+func (w *hlbWriter) typ(t hlType, fn func(int) int) {
+	w.WriteByte(byte(t.Id()))
+	switch t := t.(type) {
+	case *FunType:
+		w.WriteByte(byte(len(t.argIdx)))
+		for _, a := range t.argIdx {
+			w.index(a)
+		}
+		w.index(t.retIdx)
+	case *ObjType:
+		var bindings []hlBinding
+		for _, bd := range t.lBinding {
+			if fn(bd.funcIdx) >= 0 {
+				bindings = append(bindings, bd)
+			}
+		}
+		w.index(t.nameIdx)
+		w.index(t.superIdx)
+		w.index(t.global)
+		w.index(len(t.lField))
+		w.index(len(t.lProto))
+		w.index(len(bindings))
+		for _, f := range t.lField {
+			w.index(f.nameIdx)
+			w.index(f.typeIdx)
+		}
+		for _, p := range t.lProto {
+			w.index(p.nameIdx)
+			w.index(fn(p.funcIdx))
+			w.index(p.override)
+		}
+		for _, bd := range bindings {
+			w.index(bd.fldIdx)
+			w.index(fn(bd.funcIdx))
+		}
+	case *RefType:
+		w.index(t.paramIdx)
+	case *NullType:
+		w.index(t.paramIdx)
+	case *VirtualType:
+		w.index(len(t.field))
+		for _, f := range t.field {
+			w.index(f.nameIdx)
+			w.index(f.typeIdx)
+		}
+	case *AbstractType:
+		w.index(t.nameIdx)
+	case *EnumType:
+		w.index(t.nameIdx)
+		w.index(t.globalValue)
+		w.WriteByte(byte(len(t.lConstruct)))
+		for _, c := range t.lConstruct {
+			w.index(c.nameIdx)
+			w.index(len(c.argIdx))
+			for _, a := range c.argIdx {
+				w.index(a)
+			}
+		}
+	}
+}
+
+// instruction writes o, mapping function indexes with fn
+func (w *hlbWriter) instruction(o *HilInst, fn func(int) int) {
+	a, x := o.args(), o.extra()
+	w.WriteByte(byte(o.op))
+	switch o.op {
+	case OpCall0, OpCall1, OpCall2, OpCall3, OpCall4,
+		OpStaticClosure, OpInstanceClosure:
+		w.index(a[0])
+		w.index(fn(a[1]))
+		for _, v := range a[2:] {
+			w.index(v)
+		}
+	case OpCallN:
+		w.index(a[0])
+		w.index(fn(a[1]))
+		w.WriteByte(byte(len(x)))
+		for _, v := range x {
+			w.index(v)
+		}
+	case OpCallClosure, OpCallMethod, OpCallThis, OpMakeEnum:
+		w.index(a[0])
+		w.index(a[1])
+		w.WriteByte(byte(len(x)))
+		for _, v := range x {
+			w.index(v)
+		}
+	case OpSwitch:
+		w.index(a[0])
+		w.index(len(x))
+		for _, v := range x {
+			w.index(v)
+		}
+		w.index(a[2])
+	default:
+		for _, v := range a {
+			w.index(v)
+		}
+	}
+}
+
+// debugInfo writes the positions of n instructions. Runs on a line
+// and small line increments use the short forms of the encoding.
+func (w *hlbWriter) debugInfo(pos []hlPos, n int) {
+	at := func(i int) hlPos {
+		if i < len(pos) {
+			return pos[i]
+		}
+		return hlPos{}
+	}
+	file, line := int32(-1), int32(-1)
+	for i := 0; i < n; {
+		p := at(i)
+		if p.file != file {
+			w.WriteByte(byte(p.file>>8)<<1 | 1)
+			w.WriteByte(byte(p.file))
+			file = p.file
+		}
+		delta := p.line - line
+		switch {
+		case line >= 0 && delta == 0:
+			count := 1
+			for count < 15 && i+count < n && at(i+count) == p {
+				count++
+			}
+			w.WriteByte(byte(count<<2 | 2))
+			i += count
+			continue
+		case line >= 0 && delta > 0 && delta < 32:
+			w.WriteByte(byte(delta<<3 | 4))
+		default:
+			w.WriteByte(byte(p.line << 3))
+			w.WriteByte(byte(p.line >> 5))
+			w.WriteByte(byte(p.line >> 13))
+		}
+		line = p.line
+		i++
+	}
+}
@@ -12,4 +12,11 @@ var (
 
 var (
 	ErrBadOpCode = errors.New("Bad op code")
+	ErrBadType   = errors.New("Bad type")
+	ErrCorrupt   = errors.New("Corrupt HLB data")
+)
+
+var (
+	ErrSymbolFormat = errors.New("Unknown symbol map format")
+	ErrSymbolSyntax = errors.New("Bad symbol map syntax")
 )
@@ -0,0 +1,138 @@
+package hashlink
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// Types of the version 5 module
+const (
+	v5Void = iota
+	v5I32
+	v5Fun
+	v5Method
+	v5Point
+	v5Packed
+	v5Holder
+)
+
+// v5Module encodes a version 5 module using the struct, packed and
+// method types and the prefetch and asm instructions
+func v5Module() []byte {
+	var w hlbWriter
+	w.WriteString(Magic)
+	w.WriteByte(5)
+	w.index(0) // flags
+	w.index(1) // ints
+	w.index(0) // floats
+	w.index(4) // strings
+	w.index(1) // bytes
+	w.index(7) // types
+	w.index(0) // globals
+	w.index(0) // natives
+	w.index(1) // functions
+	w.index(0) // constants
+	w.index(0) // entry point
+
+	w.int32(42)
+	w.stringBlock([][]byte{[]byte("Point"), []byte("x"), []byte("Holder"), []byte("p")})
+	w.int32(2)
+	w.WriteString("\x90\xc3")
+	w.index(0)
+
+	w.WriteByte(byte(VoidT))
+	w.WriteByte(byte(I32T))
+	w.WriteByte(byte(FunT))
+	w.WriteByte(0)
+	w.index(v5Void)
+	w.WriteByte(byte(MethodT))
+	w.WriteByte(1)
+	w.index(v5I32)
+	w.index(v5Void)
+	w.WriteByte(byte(StructT))
+	w.index(0) // Point
+	w.index(-1)
+	w.index(0)
+	w.index(1)
+	w.index(0)
+	w.index(0)
+	w.index(1) // x
+	w.index(v5I32)
+	w.WriteByte(byte(PackedT))
+	w.index(v5Point)
+	w.WriteByte(byte(ObjT))
+	w.index(2) // Holder
+	w.index(-1)
+	w.index(0)
+	w.index(1)
+	w.index(0)
+	w.index(0)
+	w.index(3) // p
+	w.index(v5Packed)
+
+	w.index(v5Fun)
+	w.index(0)
+	w.index(3)
+	w.index(5)
+	for _, r := range []int{v5I32, v5Holder, v5Void} {
+		w.index(r)
+	}
+	for _, op := range [][]int{
+		{int(OpInt), 0, 0},
+		{int(OpNew), 1},
+		{int(OpPrefetch), 1, 0, 0},
+		{int(OpAsm), 0, 0x90, 0},
+		{int(OpRet), 2},
+	} {
+		w.WriteByte(byte(op[0]))
+		for _, v := range op[1:] {
+			w.index(v)
+		}
+	}
+	return w.Bytes()
+}
+
+func TestVersion5(t *testing.T) {
+	buf := v5Module()
+	for _, name := range []string{"NewData", "Parse"} {
+		var d *Data
+		var err error
+		if name == "NewData" {
+			d, err = NewData(buf)
+		} else {
+			d, err = Parse(bytes.NewReader(buf))
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		d.Resolve()
+
+		for i, want := range []HdtId{VoidT, I32T, FunT, MethodT, StructT, PackedT, ObjT} {
+			if id := d.LookupType(i).Id(); id != want {
+				t.Errorf("%s: type %d is %v, want %v", name, i, id, want)
+			}
+		}
+		if s := d.TypeName(d.LookupType(v5Packed)); s != "packed<Point>" {
+			t.Errorf("%s: packed type named %q", name, s)
+		}
+
+		var text []string
+		for _, l := range d.Listing(0) {
+			text = append(text, l.Text)
+		}
+		for _, op := range []string{"prefetch", "asm"} {
+			if !strings.Contains(strings.Join(text, "\n"), op) {
+				t.Errorf("%s: no %s in listing %q", name, op, text)
+			}
+		}
+
+		var out bytes.Buffer
+		if err := d.Encode(&out, nil); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(out.Bytes(), buf) {
+			t.Errorf("%s: encoding differs from the decoded module", name)
+		}
+	}
+}
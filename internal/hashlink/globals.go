@@ -0,0 +1,123 @@
+package hashlink
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// FuncRef identifies a function by index and qualified name
+type FuncRef struct {
+	Index int    `json:"index"`
+	Name  string `json:"name"`
+}
+
+// ConstField is a single decoded field of a constant initializer
+type ConstField struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// GlobalInfo describes a slot in the global table
+type GlobalInfo struct {
+	Index     int          `json:"index"`
+	Name      string       `json:"name,omitempty"`
+	Comment   string       `json:"comment,omitempty"`
+	Type      string       `json:"type"`
+	Owner     string       `json:"owner,omitempty"`
+	OwnerKind string       `json:"ownerKind,omitempty"`
+	InitBy    []FuncRef    `json:"initBy,omitempty"`
+	Constant  []ConstField `json:"constant,omitempty"`
+}
+
+// Globals returns a description of every global including the class or
+// enum it backs, the functions assigning it and any constant initializer.
+// Resolve must have been called beforehand.
+func (d *Data) Globals() []GlobalInfo {
+	res := make([]GlobalInfo, len(d.globals))
+	for i := range d.globals {
+		g := &res[i]
+		g.Index = i
+		g.Type = d.TypeName(d.globals[i])
+		if s := d.symbols.global(i); s != nil {
+			g.Name, g.Comment = s.Name, s.Comment
+		}
+		switch t := d.globalOwner[i].(type) {
+		case *ObjType:
+			g.Owner = d.strings.String(t.nameIdx)
+			g.OwnerKind = "class"
+		case *EnumType:
+			g.Owner = d.strings.String(t.nameIdx)
+			g.OwnerKind = "enum"
+		}
+	}
+
+	for _, f := range d.functions {
+		code := f.code()
+		for j := range code {
+			if code[j].op != OpSetGlobal {
+				continue
+			}
+			g := code[j].args()[0]
+			if g < 0 || g >= len(res) {
+				continue
+			}
+			init := res[g].InitBy
+			if len(init) > 0 && init[len(init)-1].Index == f.funcIdx {
+				continue
+			}
+			res[g].InitBy = append(init, FuncRef{f.funcIdx, d.FunctionName(f.funcIdx)})
+		}
+	}
+
+	for i := range d.constants {
+		c := &d.constants[i]
+		if c.globalIdx < 0 || c.globalIdx >= len(res) {
+			continue
+		}
+		res[c.globalIdx].Constant = d.decodeConstant(c)
+	}
+
+	return res
+}
+
+// decodeConstant maps the field indexes of a constant initializer
+// to values. The meaning of each index depends on the field type,
+// see hl_module_init_constant() in module.c.
+func (d *Data) decodeConstant(c *hlConstant) []ConstField {
+	t, ok := d.globals[c.globalIdx].(*ObjType)
+	if !ok {
+		return nil
+	}
+	fields := t.fields()
+	res := make([]ConstField, len(c.fields))
+	for i, idx := range c.fields {
+		var ft hlType
+		if i < len(fields) {
+			res[i].Name = d.strings.String(fields[i].nameIdx)
+			ft = d.LookupType(fields[i].typeIdx)
+		}
+		res[i].Type = d.TypeName(ft)
+		switch ft.(type) {
+		case *I32Type:
+			if idx < len(d.ints) {
+				res[i].Value = strconv.Itoa(d.ints[idx])
+			}
+		case *BoolType:
+			res[i].Value = strconv.FormatBool(idx != 0)
+		case *F64Type:
+			if idx < len(d.floats) {
+				res[i].Value = strconv.FormatFloat(d.floats[idx], 'g', -1, 64)
+			}
+		case *BytesType:
+			res[i].Value = strconv.Quote(d.strings.String(idx))
+		case *TypeType:
+			if idx < len(d.types) {
+				res[i].Value = d.TypeName(d.types[idx])
+			}
+		default:
+			res[i].Value = fmt.Sprintf("global@%d", idx)
+		}
+	}
+	return res
+}
@@ -2,35 +2,78 @@ package hashlink
 
 import (
 	"fmt"
-	"log"
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
 )
 
 const (
 	Magic = "HLB"
+
+	// Supported range of HLB versions
+	MinVersion = 2
+	MaxVersion = 5
 )
 
 type Data struct {
-	version    int
-	flags      Flags
-	entryPoint int
-	ints       []int
-	floats     []float64
-	strings    StringContainer
-	types      []hlType
-	globals    []hlType
-	natives    []*hlNative
-	functions  []*hlFunction
-	funcLookup []int
-	debugFiles []LineFile
+	version     int
+	flags       Flags
+	entryPoint  int
+	ints        []int
+	floats      []float64
+	strings     StringContainer
+	bytes       StringContainer
+	types       []hlType
+	globals     []hlType
+	globalOwner []hlType
+	natives     []*hlNative
+	functions   []*hlFunction
+	constants   []hlConstant
+	funcLookup  []int
+	debugFiles  []LineFile
+	symbols     *SymbolMap
+	typeSymbols map[hlType]*Symbol
+	funcNames   map[string]int
+	lambdas     map[int]lambda
+	lambdaOnce  sync.Once
+	subclasses  map[*ObjType][]*ObjType
+	closures    map[int][]int
+	mapped      []byte
+	sections    []Section
+}
+
+// Section is the encoded size of a part of the module
+type Section struct {
+	Name string `json:"name"`
+	Size int    `json:"size"`
+}
+
+// section records the size of the section ending at the current
+// stream position.
+func (d *Data) section(name string, b stream) {
+	end := b.pos()
+	for _, s := range d.sections {
+		end -= s.Size
+	}
+	d.sections = append(d.sections, Section{name, end})
 }
 
 func (d *Data) LookupInt(i int) int       { return d.ints[i] }
 func (d *Data) LookupFloat(i int) float64 { return d.floats[i] }
 
-//func (d *Data) LookupString(i int) []byte { return d.strings[i] }
-func (d *Data) LookupType(i int) hlType   { return d.types[i] }
+// func (d *Data) LookupString(i int) []byte { return d.strings[i] }
+func (d *Data) LookupType(i int) hlType {
+	if i < 0 || i >= len(d.types) {
+		return nil
+	}
+	return d.types[i]
+}
 func (d *Data) LookupGlobal(i int) hlType { return d.globals[i] }
 func (d *Data) LookupFunction(i int) Function {
+	if i < 0 || i >= len(d.funcLookup) {
+		return nil
+	}
 	idx := d.funcLookup[i]
 	if idx < len(d.functions) {
 		return d.functions[idx]
@@ -45,23 +88,32 @@ func (d *Data) LookupFunction(i int) Function {
 func (d *Data) Dump() {
 	for i := range d.functions {
 		f := d.functions[i]
-		fmt.Printf("fun@%d", f.funcIdx)
-		fobj := d.LookupType(f.typeIdx).(*FunType)
-		for j := 0; j < len(fobj.argPtr); j++ {
-			fmt.Printf("%s,", fobj.argPtr[j].Id())
+		fmt.Printf("fun@%d %s %s", f.funcIdx, d.FunctionName(f.funcIdx), d.TypeName(d.LookupType(f.typeIdx)))
+		if env := d.ClosureEnv(f.funcIdx); env != "" {
+			fmt.Printf(" captures %s", env)
+		}
+		if c := d.FunctionComment(f.funcIdx); c != "" {
+			fmt.Printf(" ; %s", c)
 		}
-		fmt.Printf("%s\n", fobj.retPtr.Id())
-		for j := range f.inst {
-			f.inst[j].Print(d)
+		fmt.Println()
+		for _, l := range d.funcListing(f, noLink) {
+			if l.PC < 0 {
+				fmt.Printf("\t%s\n", l.Text)
+				continue
+			}
+			fmt.Printf("\t@%d %s", l.PC, l.Text)
+			if l.Note != "" {
+				fmt.Printf(" ; %s", l.Note)
+			}
+			fmt.Println()
 		}
 	}
 	for i := range d.types {
 		switch t := d.types[i].(type) {
 		case *ObjType:
 			var extIdx int
-			if t.superIdx > 0 {
-				super := d.LookupType(t.superIdx).(*ObjType)
-				extIdx = super.nameIdx
+			if t.superPtr != nil {
+				extIdx = t.superPtr.nameIdx
 			}
 			fmt.Printf("@%d Class: %s, Global: %d, Extends: %s\n", i, t.namePtr, t.global, d.strings.String(extIdx))
 			fmt.Printf("\t%d fields\n", len(t.lField))
@@ -96,6 +148,10 @@ func (d *Data) Dump() {
 			}
 		}
 	}
+	for i := range d.natives {
+		n := d.natives[i]
+		fmt.Printf("@%d Native: %s.%s %s\n", n.funcIdx, n.libPtr, n.namePtr, d.TypeName(d.LookupType(n.typeIdx)))
+	}
 }
 
 func (d *Data) Resolve() {
@@ -120,12 +176,49 @@ func (d *Data) Resolve() {
 			t.retPtr = d.LookupType(t.retIdx)
 		case *ObjType:
 			t.namePtr = d.strings.Bytes(t.nameIdx)
-			// TODO: Init global value
+			if t.superIdx > 0 {
+				t.superPtr, _ = d.LookupType(t.superIdx).(*ObjType)
+			}
+			if t.global > 0 {
+				d.globalOwner[t.global-1] = t
+			}
 			for j := 0; j < len(t.lProto); j++ {
 				p := t.lProto[j]
-				f := d.LookupFunction(p.funcIdx).(*hlFunction)
+				if f, ok := d.LookupFunction(p.funcIdx).(*hlFunction); ok {
+					f.obj = t
+					f.field = d.strings.Bytes(p.nameIdx)
+				}
+			}
+		case *EnumType:
+			t.namePtr = d.strings.Bytes(t.nameIdx)
+			if t.globalValue > 0 {
+				d.globalOwner[t.globalValue-1] = t
+			}
+		case *AbstractType:
+			t.namePtr = d.strings.Bytes(t.nameIdx)
+		case *RefType:
+			t.paramPtr = d.LookupType(t.paramIdx)
+		case *NullType:
+			t.paramPtr = d.LookupType(t.paramIdx)
+		}
+	}
+
+	// Static methods are bound to fields of the class object and
+	// can only be named once all super classes are resolved.
+	for i := range d.types {
+		t, ok := d.types[i].(*ObjType)
+		if !ok {
+			continue
+		}
+		for j := range t.lBinding {
+			b := t.lBinding[j]
+			fld := t.field(b.fldIdx)
+			if fld == nil {
+				continue
+			}
+			if f, ok := d.LookupFunction(b.funcIdx).(*hlFunction); ok && f.obj == nil {
 				f.obj = t
-				f.field = d.strings.Bytes(p.nameIdx)
+				f.field = d.strings.Bytes(fld.nameIdx)
 			}
 		}
 	}
@@ -136,13 +229,25 @@ type StringContainer struct {
 	index [][]byte
 }
 
+// Len returns the number of entries
+func (s *StringContainer) Len() int { return len(s.index) }
+
+// Range calls fn for every entry in index order until fn returns false
+func (s *StringContainer) Range(fn func(i int, b []byte) bool) {
+	for i, b := range s.index {
+		if !fn(i, b) {
+			return
+		}
+	}
+}
+
 func (s *StringContainer) Append(b []byte) {
 	s.data = append(s.data, b...)
 	s.index = append(s.index, s.data[len(s.data)-len(b):])
 }
 
 func (s *StringContainer) Bytes(i int) []byte {
-	if i >= len(s.index) {
+	if i < 0 || i >= len(s.index) {
 		return nil
 	}
 	return s.index[i]
@@ -152,76 +257,176 @@ func (s *StringContainer) String(i int) string {
 	return string(s.Bytes(i))
 }
 
+// readBytes reads the bytes pool of v5 modules. Entries are given as
+// offsets into a single blob, each ending where the next one starts.
+// The blob is copied as the stream may be a mapping released by Close.
+func (d *Data) readBytes(b stream, n int) {
+	size := int(b.int32())
+	if size < 0 {
+		b.fail(ErrCorrupt)
+		return
+	}
+	blob := append([]byte(nil), b.bytes(size)...)
+	pos := make([]int, n)
+	for i := range pos {
+		pos[i] = b.index()
+	}
+	if b.err() != nil {
+		return
+	}
+
+	ends := append([]int(nil), pos...)
+	ends = append(ends, len(blob))
+	sort.Ints(ends)
+	d.bytes.data = blob
+	d.bytes.index = make([][]byte, n)
+	for i, p := range pos {
+		if p < 0 || p > len(blob) {
+			continue
+		}
+		end := len(blob)
+		if j := sort.SearchInts(ends, p+1); j < len(ends) && ends[j] < end {
+			end = ends[j]
+		}
+		d.bytes.index[i] = blob[p:end]
+	}
+}
+
+// pool returns the container holding the constants loaded by op,
+// which is the bytes pool for OpBytes in v5 modules and the string
+// pool otherwise.
+func (d *Data) pool(op HilOp) *StringContainer {
+	if op == OpBytes && d.version >= 5 {
+		return &d.bytes
+	}
+	return &d.strings
+}
+
 type LineFile string
 
+// Options control how a module is decoded
+type Options struct {
+	// LazyCode defers decoding of function bodies until they are
+	// first used, keeping the encoded instructions instead. Bodies
+	// failing to decode are reported by DecodeFunctions.
+	LazyCode bool
+
+	// Workers is the number of goroutines decoding function bodies
+	// once their extent is known. Values below 2 decode serially.
+	// Ignored with LazyCode.
+	Workers int
+}
+
+// NewData decodes a module held in memory. See NewDataOptions.
 func NewData(b hlbStream) (*Data, error) {
+	return decode(newSliceStream(b), nil)
+}
+
+// Parse decodes a module read from r
+func Parse(r io.Reader) (*Data, error) {
+	return ParseOptions(r, nil)
+}
+
+// ParseOptions decodes a module read from r as directed by opt.
+// Sections are decoded as they are read so the module does not
+// have to be held in memory in its encoded form.
+func ParseOptions(r io.Reader, opt *Options) (*Data, error) {
+	return decode(newReaderStream(r), opt)
+}
+
+func decode(b stream, opt *Options) (*Data, error) {
 	d := new(Data)
+	if opt == nil {
+		opt = new(Options)
+	}
 
 	// Verify existence of the magic HLB identifier
-	if Magic != string(b[0:3]) {
+	if Magic != string(b.bytes(len(Magic))) {
+		if err := b.err(); err != nil {
+			return nil, err
+		}
 		return nil, ErrNotValidHLB
 	}
-	b.skip(len(Magic))
 
 	// Bail on fast on unsupported HLB version
 	d.version = int(b.byte())
-	if d.version != 2 {
+	if d.version < MinVersion || d.version > MaxVersion {
 		return nil, ErrUnsupported
 	}
 
 	d.flags = Flags(b.index())
-	d.ints = make([]int, b.index())
-	d.floats = make([]float64, b.index())
-	nStrings := b.index()
-	d.types = make([]hlType, b.index())
-	d.globals = make([]hlType, b.index())
-	d.natives = make([]*hlNative, b.index())
-	d.functions = make([]*hlFunction, b.index())
+	d.ints = make([]int, count(b))
+	d.floats = make([]float64, count(b))
+	nStrings := count(b)
+	nBytes := 0
+	if d.version >= 5 {
+		nBytes = count(b)
+	}
+	d.types = make([]hlType, count(b))
+	d.globals = make([]hlType, count(b))
+	d.globalOwner = make([]hlType, len(d.globals))
+	d.natives = make([]*hlNative, count(b))
+	d.functions = make([]*hlFunction, count(b))
 	d.funcLookup = make([]int, len(d.natives)+len(d.functions))
+	if d.version >= 4 {
+		d.constants = make([]hlConstant, count(b))
+	}
 	d.entryPoint = b.index()
+	if err := b.err(); err != nil {
+		return nil, err
+	}
+	d.section("header", b)
 
 	for i := range d.ints {
 		d.ints[i] = int(b.int32())
 	}
-
-	fmt.Printf("Version: %d\nFlags: %x\n", d.version, d.flags)
-	fmt.Printf("Ints: %d\nFloats: %d\nStrings: %d\nTypes: %d\nGlobals: %d\nNatives: %d\nFunctions: %d\n",
-		len(d.ints), len(d.floats), nStrings, len(d.types), len(d.globals), len(d.natives), len(d.functions))
+	d.section("ints", b)
 
 	for i := range d.floats {
 		d.floats[i] = b.float64()
 	}
+	d.section("floats", b)
 
-	skip := int(b.int32())
-	tmpBuf := b[:skip]
-	b.skip(skip)
-	for i := 0; i < nStrings; i++ {
-		sz := b.index()
-		d.strings.Append(tmpBuf[:sz])
-		tmpBuf = tmpBuf[sz+1:]
+	for _, s := range readStrings(b, nStrings) {
+		d.strings.Append(s)
+	}
+	if err := b.err(); err != nil {
+		return nil, err
+	}
+	d.section("strings", b)
+
+	if d.version >= 5 {
+		d.readBytes(b, nBytes)
+		if err := b.err(); err != nil {
+			return nil, err
+		}
+		d.section("bytes", b)
 	}
 
 	if d.flags.HasDebug() {
-		nDebugFile := b.index()
-		d.debugFiles = make([]LineFile, nDebugFile)
-		skip := int(b.int32())
-		tmpBuf := b[:skip]
-		b.skip(skip)
-		for i := range d.debugFiles {
-			sz := b.index()
-			d.debugFiles[i] = LineFile(tmpBuf[:sz])
-			tmpBuf = tmpBuf[sz+1:]
+		files := readStrings(b, count(b))
+		d.debugFiles = make([]LineFile, len(files))
+		for i := range files {
+			d.debugFiles[i] = LineFile(files[i])
+		}
+		if err := b.err(); err != nil {
+			return nil, err
 		}
+		d.section("debug files", b)
 	}
 
 	for i := range d.types {
-		d.types[i] = readType(d, &b)
+		d.types[i] = readType(d, b)
+		if err := b.err(); err != nil {
+			return nil, err
+		}
 	}
+	d.section("types", b)
 
 	for i := range d.globals {
 		d.globals[i] = d.LookupType(b.index())
-		//fmt.Printf("\t@%d %T\n", i, d.lGlobal[i])
 	}
+	d.section("globals", b)
 
 	for i := range d.natives {
 		n := new(hlNative)
@@ -230,40 +435,215 @@ func NewData(b hlbStream) (*Data, error) {
 		n.typeIdx = b.index()
 		n.funcIdx = b.index()
 		d.natives[i] = n
-		//fmt.Printf("Lib: %s, %s, %d=%d\n", d.strings.String(n.libIdx), d.strings.String(n.nameIdx), n.funcIdx, i+len(d.functions))
 	}
+	if err := b.err(); err != nil {
+		return nil, err
+	}
+	d.section("natives", b)
 
 	for i := range d.functions {
 		f := new(hlFunction)
 		f.typeIdx = b.index()
 		f.funcIdx = b.index()
-		nReg := b.index()
-		nInst := b.index()
+		nReg := count(b)
+		f.nInst = count(b)
 
-		//fmt.Printf("New func [%d] %T (%d,%d)\n", f.funcIdx, f.typePtr, nReg, nInst)
 		f.regIdx = make([]int, nReg)
 		for i := 0; i < nReg; i++ {
 			f.regIdx[i] = b.index()
 		}
-		f.inst = make([]HilInst, nInst)
-		for i := 0; i < nInst; i++ {
-			readInstruction(&b, &f.inst[i])
+		if opt.LazyCode || opt.Workers > 1 {
+			// Only find the extent of the body, decoding is deferred
+			b.record()
+			for i := 0; i < f.nInst; i++ {
+				if err := skipInstruction(b); err != nil {
+					return nil, err
+				}
+				if err := b.err(); err != nil {
+					return nil, err
+				}
+			}
+			if d.flags.HasDebug() {
+				readDebugInfo(b, f.nInst, nil)
+			}
+			f.body = b.recorded()
+		} else {
+			f.inst = make([]HilInst, f.nInst)
+			f.arena = make([]int, 0, arenaHint*f.nInst)
+			for i := range f.inst {
+				if err := readInstruction(b, &f.inst[i], &f.arena); err != nil {
+					return nil, err
+				}
+				if err := b.err(); err != nil {
+					return nil, err
+				}
+			}
+			if d.flags.HasDebug() {
+				f.pos = make([]hlPos, f.nInst)
+				readDebugInfo(b, f.nInst, f.pos)
+			}
 		}
 
-		if d.flags.HasDebug() {
-			readDebugInfo(&b, nInst) // Use lInst?
+		if d.flags.HasDebug() && d.version >= 3 {
+			f.assigns = make([]hlAssign, count(b))
+			for i := range f.assigns {
+				f.assigns[i].nameIdx = b.index()
+				f.assigns[i].pos = b.index()
+			}
+		}
+		if err := b.err(); err != nil {
+			return nil, err
 		}
 		d.functions[i] = f
 	}
+	if err := d.checkIndexes(); err != nil {
+		return nil, err
+	}
+	d.section("functions", b)
+
+	for i := range d.constants {
+		c := &d.constants[i]
+		c.globalIdx = b.index()
+		c.fields = make([]int, count(b))
+		for j := range c.fields {
+			c.fields[j] = b.index()
+		}
+	}
+	if err := b.err(); err != nil {
+		return nil, err
+	}
+	if d.version >= 4 {
+		d.section("constants", b)
+	}
+
+	if !opt.LazyCode && opt.Workers > 1 {
+		if err := d.DecodeFunctions(opt.Workers); err != nil {
+			return nil, err
+		}
+	}
 
 	return d, nil
 }
 
-func readType(ctx *Data, b *hlbStream) hlType {
+// checkIndexes verifies that every function index is used once and
+// that classes and enums refer to existing globals, as Resolve relies
+// on both.
+func (d *Data) checkIndexes() error {
+	seen := make([]bool, len(d.funcLookup))
+	use := func(idx int) bool {
+		if idx < 0 || idx >= len(seen) || seen[idx] {
+			return false
+		}
+		seen[idx] = true
+		return true
+	}
+	for _, f := range d.functions {
+		if !use(f.funcIdx) {
+			return ErrCorrupt
+		}
+	}
+	for _, n := range d.natives {
+		if !use(n.funcIdx) {
+			return ErrCorrupt
+		}
+	}
+	for _, t := range d.types {
+		global := 0
+		switch t := t.(type) {
+		case *ObjType:
+			global = t.global
+		case *EnumType:
+			global = t.globalValue
+		}
+		if global > len(d.globals) {
+			return ErrCorrupt
+		}
+	}
+	return nil
+}
+
+// maxCount bounds the size of tables read from a stream of unknown
+// length
+const maxCount = 1 << 24
+
+// count reads the size of a table, failing the stream if negative or
+// larger than the bytes left, as every entry takes at least one.
+func count(b stream) int {
+	n := b.index()
+	max := b.left()
+	if max < 0 {
+		max = maxCount
+	}
+	if n < 0 || n > max {
+		b.fail(ErrCorrupt)
+		return 0
+	}
+	return n
+}
+
+// readStrings reads a string table of n entries: the size of a NUL
+// separated blob, the blob and the size of each string.
+func readStrings(b stream, n int) [][]byte {
+	size := int(b.int32())
+	if size < 0 {
+		b.fail(ErrCorrupt)
+		return nil
+	}
+	blob := b.bytes(size)
+	res := make([][]byte, 0, n)
+	for i := 0; i < n && b.err() == nil; i++ {
+		sz := b.index()
+		if sz < 0 || sz >= len(blob) {
+			b.fail(ErrCorrupt)
+			return nil
+		}
+		res = append(res, blob[:sz])
+		blob = blob[sz+1:]
+	}
+	return res
+}
+
+// DecodeFunctions decodes all function bodies not yet decoded using
+// the given number of goroutines. The result is identical to decoding
+// serially as each function only depends on its own encoded bytes.
+// The first function failing to decode is reported, such functions
+// keep the instructions preceding the error.
+func (d *Data) DecodeFunctions(workers int) error {
+	if workers < 1 {
+		workers = 1
+	}
+	var next int64 = -1
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(atomic.AddInt64(&next, 1))
+				if i >= len(d.functions) {
+					return
+				}
+				d.functions[i].code()
+			}
+		}()
+	}
+	wg.Wait()
+	for _, f := range d.functions {
+		if f.err != nil {
+			return fmt.Errorf("fun@%d: %w", f.funcIdx, f.err)
+		}
+	}
+	return nil
+}
+
+// readType reads a type definition, failing the stream on unknown
+// kinds of type
+func readType(ctx *Data, b stream) hlType {
 	typeId := HdtId(b.byte())
 	t := typeId.NewType()
 	if t == nil {
-		log.Fatalf("Unknown type: %d\n", typeId)
+		b.fail(fmt.Errorf("%w: kind %d", ErrBadType, typeId))
+		return nil
 	}
 
 	switch t := t.(type) {
@@ -300,71 +680,117 @@ func readType(ctx *Data, b *hlbStream) hlType {
 	return t
 }
 
-func readInstruction(b *hlbStream, inst *HilInst) error {
+// readInstruction decodes an instruction into inst, appending its
+// operands to the function operand arena.
+func readInstruction(b opReader, inst *HilInst, arena *[]int) error {
 	inst.op = HilOp(b.byte())
 	if int(inst.op) >= len(OpCodes) {
 		return ErrBadOpCode
 	}
 
+	a := *arena
+	inst.arena = arena
+	inst.off = int32(len(a))
 	nArg := OpCodes[inst.op].args
 	switch nArg {
 	case 0:
-		return nil
 	case -1:
-		inst.arg = make([]int, 3)
+		inst.nArg = 3
 		switch inst.op {
 		case OpCallN, OpCallClosure, OpCallMethod,
 			OpCallThis, OpMakeEnum:
-			inst.arg[0] = b.index()
-			inst.arg[1] = b.index()
-			inst.arg[2] = int(b.byte())
-			inst.extra = make([]int, inst.arg[2])
-			for i := 0; i < inst.arg[2]; i++ {
-				inst.extra[i] = b.index()
+			a = append(a, b.index(), b.index(), int(b.byte()))
+			n := a[len(a)-1]
+			for i := 0; i < n; i++ {
+				a = append(a, b.index())
 			}
+			inst.nExtra = uint32(n)
 		case OpSwitch:
-			inst.arg[0] = b.index()
-			inst.arg[1] = b.index()
-			inst.extra = make([]int, inst.arg[1])
-			for i := 0; i < inst.arg[1]; i++ {
-				inst.extra[i] = b.index()
+			// The default target follows the case targets
+			a = append(a, b.index(), b.index(), 0)
+			n := a[len(a)-2]
+			if n < 0 {
+				return ErrBadOpCode
+			}
+			for i := 0; i < n; i++ {
+				a = append(a, b.index())
 			}
-			inst.arg[2] = b.index()
+			a[inst.off+2] = b.index()
+			inst.nExtra = uint32(n)
 		default:
-			log.Fatal("Not implemented!")
+			return ErrBadOpCode
 		}
 	default:
-		inst.arg = make([]int, nArg)
 		for i := 0; i < nArg; i++ {
-			inst.arg[i] = b.index()
+			a = append(a, b.index())
 		}
+		inst.nArg = uint8(nArg)
 	}
+	*arena = a
 	return nil
 }
 
-// TODO finish implementation
-func readDebugInfo(b *hlbStream, nOp int) {
-	//var file int
-	var line int
+// skipInstruction reads past an instruction without decoding it
+func skipInstruction(b opReader) error {
+	op := HilOp(b.byte())
+	if int(op) >= len(OpCodes) {
+		return ErrBadOpCode
+	}
+
+	nArg := OpCodes[op].args
+	switch nArg {
+	case -1:
+		switch op {
+		case OpCallN, OpCallClosure, OpCallMethod,
+			OpCallThis, OpMakeEnum:
+			b.index()
+			b.index()
+			nArg = int(b.byte())
+		case OpSwitch:
+			b.index()
+			nArg = b.index() + 1
+		default:
+			return ErrBadOpCode
+		}
+	}
+	for i := 0; i < nArg; i++ {
+		b.index()
+	}
+	return nil
+}
+
+// readDebugInfo reads the source positions of nOp instructions,
+// storing them in pos unless it is nil. See hl_read_debug_infos()
+// in code.c for the encoding.
+func readDebugInfo(b opReader, nOp int, pos []hlPos) {
+	var file, line int
+	set := func(i int) {
+		if i < len(pos) {
+			pos[i] = hlPos{int32(file), int32(line)}
+		}
+	}
 	for i := 0; i < nOp; {
 		c := int(b.byte())
 		switch {
 		case (c & 1) == 1:
-			//file = ((c << 7) & 0x7f00) + int(b.byte())
-			b.byte()
+			file = (c>>1)<<8 | int(b.byte())
 		case (c & 2) == 2:
 			delta := c >> 6
 			count := (c >> 2) & 0xf
 			for j := 0; j < count; j++ {
+				set(i)
 				i++
 			}
 			line += delta
 		case (c & 4) == 4:
 			line += c >> 3
+			set(i)
 			i++
 		default:
-			b.byte()
-			b.byte()
+			b2 := int(b.byte())
+			b3 := int(b.byte())
+			line = (c >> 3) | (b2 << 5) | (b3 << 13)
+			set(i)
 			i++
 		}
 	}
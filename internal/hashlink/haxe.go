@@ -0,0 +1,399 @@
+package hashlink
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// HaxeFile is a generated Haxe module. Path is relative to the class
+// path root, e.g. a/b/Foo.hx for class a.b.Foo.
+type HaxeFile struct {
+	Path   string
+	Source string
+}
+
+// haxeStd lists the top level types of the Haxe standard library,
+// which are left out of generated externs with the hl, haxe and sys
+// packages
+var haxeStd = map[string]bool{
+	"Array": true, "Class": true, "Date": true, "EReg": true, "Enum": true,
+	"EnumValue": true, "IntIterator": true, "Lambda": true, "List": true,
+	"Math": true, "Reflect": true, "Std": true, "String": true, "StringBuf": true,
+	"StringTools": true, "Sys": true, "Type": true, "ValueType": true, "Xml": true,
+	"XmlType": true,
+}
+
+// isHaxeStd reports whether type name belongs to the standard library
+func isHaxeStd(name string) bool {
+	for _, p := range []string{"hl.", "haxe.", "sys."} {
+		if strings.HasPrefix(name, p) {
+			return true
+		}
+	}
+	return haxeStd[name]
+}
+
+// haxeKeywords are the reserved words of Haxe
+var haxeKeywords = map[string]bool{
+	"abstract": true, "break": true, "case": true, "cast": true, "catch": true,
+	"class": true, "continue": true, "default": true, "do": true, "dynamic": true,
+	"else": true, "enum": true, "extends": true, "extern": true, "false": true,
+	"final": true, "for": true, "function": true, "if": true, "implements": true,
+	"import": true, "in": true, "inline": true, "interface": true, "macro": true,
+	"new": true, "null": true, "operator": true, "overload": true, "override": true,
+	"package": true, "private": true, "public": true, "return": true, "static": true,
+	"switch": true, "this": true, "throw": true, "true": true, "try": true,
+	"typedef": true, "untyped": true, "using": true, "var": true, "while": true,
+}
+
+// haxeIdent turns s into a Haxe identifier
+func haxeIdent(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if c != '_' && (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (c < '0' || c > '9' || i == 0) {
+			b[i] = '_'
+		}
+	}
+	if len(b) == 0 || haxeKeywords[string(b)] {
+		return "_" + string(b)
+	}
+	return string(b)
+}
+
+// haxePath reports whether name is a valid dotted Haxe type path
+func haxePath(name string) bool {
+	l := strings.Split(name, ".")
+	for i, s := range l {
+		if s == "" || haxeIdent(s) != s {
+			return false
+		}
+		if c := s[0]; i == len(l)-1 && (c < 'A' || c > 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+// haxeGen holds the state of extern generation
+type haxeGen struct {
+	d     *Data
+	index map[hlType]int
+}
+
+// virtualName returns the name of the typedef generated for the
+// virtual of type index i
+func virtualName(i int) string {
+	return "Virtual" + strconv.Itoa(i)
+}
+
+// haxeType returns the Haxe type expression for t. Classes, enums and
+// virtuals are referred to by their full path, anything without a
+// Haxe equivalent is Dynamic.
+func (g *haxeGen) haxeType(t hlType, depth int) string {
+	d := g.d
+	if depth > maxTypeDepth {
+		return "Dynamic"
+	}
+	depth++
+	switch t := t.(type) {
+	case *VoidType:
+		return "Void"
+	case *UI8Type:
+		return "hl.UI8"
+	case *UI16Type:
+		return "hl.UI16"
+	case *I32Type:
+		return "Int"
+	case *I64Type:
+		return "hl.I64"
+	case *F32Type:
+		return "Single"
+	case *F64Type:
+		return "Float"
+	case *BoolType:
+		return "Bool"
+	case *BytesType:
+		return "hl.Bytes"
+	case *FunType:
+		args := make([]string, len(t.argIdx))
+		for i := range t.argIdx {
+			args[i] = g.haxeType(d.LookupType(t.argIdx[i]), depth)
+		}
+		ret := g.haxeType(d.LookupType(t.retIdx), depth)
+		if len(args) == 1 && !strings.Contains(args[0], "->") {
+			return args[0] + " -> " + ret
+		}
+		return "(" + strings.Join(args, ", ") + ") -> " + ret
+	case *ObjType:
+		name := d.strings.String(t.nameIdx)
+		if strings.HasPrefix(name, "$") && haxePath(name[1:]) {
+			return "Class<" + name[1:] + ">"
+		}
+		if haxePath(name) {
+			return name
+		}
+	case *ArrayType:
+		return "hl.NativeArray<Dynamic>"
+	case *TypeType:
+		return "hl.Type"
+	case *RefType:
+		if t.packed {
+			return g.haxeType(d.LookupType(t.paramIdx), depth)
+		}
+		return "hl.Ref<" + g.haxeType(d.LookupType(t.paramIdx), depth) + ">"
+	case *VirtualType:
+		return "Virtuals." + virtualName(g.index[t])
+	case *AbstractType:
+		return "hl.Abstract<" + strconv.Quote(d.strings.String(t.nameIdx)) + ">"
+	case *EnumType:
+		if name := d.strings.String(t.nameIdx); haxePath(name) {
+			return name
+		}
+	case *NullType:
+		return "Null<" + g.haxeType(d.LookupType(t.paramIdx), depth) + ">"
+	}
+	return "Dynamic"
+}
+
+// typeString returns the Haxe type expression for type index i
+func (g *haxeGen) typeString(i int) string {
+	return g.haxeType(g.d.LookupType(i), 0)
+}
+
+// signature formats the arguments and return type of function fn,
+// skipping the first skip arguments. Arguments are named after the
+// registers holding them when the symbol map names them.
+func (g *haxeGen) signature(fn, skip int) string {
+	args, ret, ok := g.d.FunctionArgs(fn)
+	if !ok {
+		return "() : Dynamic"
+	}
+	l := make([]string, 0, len(args))
+	for r := skip; r < len(args); r++ {
+		name := "a" + strconv.Itoa(r-skip)
+		if s := g.d.symbols.register(fn, r); s != nil && s.Name != "" {
+			name = haxeIdent(s.Name)
+		}
+		l = append(l, name+" : "+g.typeString(args[r]))
+	}
+	return "(" + strings.Join(l, ", ") + ") : " + g.typeString(ret)
+}
+
+// file starts a module for type path name
+func file(name string) (HaxeFile, *strings.Builder) {
+	var b strings.Builder
+	pkg, base := "", name
+	if i := strings.LastIndexByte(name, '.'); i >= 0 {
+		pkg, base = name[:i], name[i+1:]
+	}
+	if pkg == "" {
+		b.WriteString("package;\n\n")
+	} else {
+		fmt.Fprintf(&b, "package %s;\n\n", pkg)
+	}
+	return HaxeFile{Path: path.Join(append(strings.Split(pkg, "."), base+".hx")...)}, &b
+}
+
+// class generates the extern class of o, or of its static class object
+// statics alone when o is nil
+func (g *haxeGen) class(name string, o, statics *ObjType) HaxeFile {
+	d := g.d
+	f, b := file(name)
+	base := name[strings.LastIndexByte(name, '.')+1:]
+	fmt.Fprintf(b, "extern class %s", base)
+	if o != nil && o.superPtr != nil {
+		if s := d.strings.String(o.superPtr.nameIdx); haxePath(s) {
+			fmt.Fprintf(b, " extends %s", s)
+		}
+	}
+	b.WriteString(" {\n")
+	members := func(t *ObjType, static string) {
+		bound := make(map[int]int)
+		for _, bd := range t.lBinding {
+			bound[bd.fldIdx-t.offset] = bd.funcIdx
+		}
+		skip := 0
+		if static == "" {
+			skip = 1
+		}
+		for i, fld := range t.lField {
+			fname := haxeIdent(d.strings.String(fld.nameIdx))
+			if fn, ok := bound[i]; ok {
+				fmt.Fprintf(b, "\t%sfunction %s%s;\n", static, fname, g.signature(fn, skip))
+				continue
+			}
+			fmt.Fprintf(b, "\t%svar %s : %s;\n", static, fname, g.typeString(fld.typeIdx))
+		}
+		if static != "" {
+			return
+		}
+		for _, p := range t.lProto {
+			// A slot of -1 marks a method that is not virtual
+			override := ""
+			if p.override >= 0 && t.superPtr.hasProto(p.nameIdx) {
+				override = "override "
+			}
+			fmt.Fprintf(b, "\t%sfunction %s%s;\n", override, haxeIdent(d.strings.String(p.nameIdx)), g.signature(p.funcIdx, skip))
+		}
+	}
+	if statics != nil {
+		members(statics, "static ")
+	}
+	if o != nil {
+		members(o, "")
+	}
+	b.WriteString("}\n")
+	f.Source = b.String()
+	return f
+}
+
+// enum generates the enum of e
+func (g *haxeGen) enum(name string, e *EnumType) HaxeFile {
+	f, b := file(name)
+	fmt.Fprintf(b, "enum %s {\n", name[strings.LastIndexByte(name, '.')+1:])
+	for _, c := range e.lConstruct {
+		b.WriteString("\t" + haxeIdent(g.d.strings.String(c.nameIdx)))
+		if len(c.argIdx) > 0 {
+			args := make([]string, len(c.argIdx))
+			for i, a := range c.argIdx {
+				args[i] = "p" + strconv.Itoa(i) + " : " + g.typeString(a)
+			}
+			b.WriteString("(" + strings.Join(args, ", ") + ")")
+		}
+		b.WriteString(";\n")
+	}
+	b.WriteString("}\n")
+	f.Source = b.String()
+	return f
+}
+
+// virtuals generates a typedef for every virtual of the module, or
+// returns false if there is none
+func (g *haxeGen) virtuals() (HaxeFile, bool) {
+	f, b := file("Virtuals")
+	first := true
+	for i, t := range g.d.types {
+		v, ok := t.(*VirtualType)
+		if !ok {
+			continue
+		}
+		if !first {
+			b.WriteString("\n")
+		}
+		first = false
+		fmt.Fprintf(b, "typedef %s = {\n", virtualName(i))
+		for _, fld := range v.field {
+			fmt.Fprintf(b, "\tvar %s : %s;\n", haxeIdent(g.d.strings.String(fld.nameIdx)), g.typeString(fld.typeIdx))
+		}
+		b.WriteString("}\n")
+	}
+	f.Source = b.String()
+	return f, !first
+}
+
+// nativesClass returns the class holding the natives of library lib.
+// A library loaded on demand, marked by a leading ?, shares the class
+// of the library.
+func nativesClass(lib string) string {
+	name := haxeIdent(strings.TrimPrefix(lib, "?"))
+	return "natives." + strings.ToUpper(name[:1]) + name[1:]
+}
+
+// natives generates class name of static functions bound to natives l.
+// Natives of the same name from several libraries are declared once.
+func (g *haxeGen) natives(name string, l []*hlNative) HaxeFile {
+	f, b := file(name)
+	fmt.Fprintf(b, "extern class %s {\n", name[len("natives."):])
+	seen := make(map[string]bool)
+	for _, n := range l {
+		fname := haxeIdent(n.namePtr)
+		if seen[fname] {
+			continue
+		}
+		seen[fname] = true
+		fmt.Fprintf(b, "\t@:hlNative(%s, %s) static function %s%s;\n",
+			strconv.Quote(n.libPtr), strconv.Quote(n.namePtr), fname, g.signature(n.funcIdx, 0))
+	}
+	b.WriteString("}\n")
+	f.Source = b.String()
+	return f
+}
+
+// HaxeExterns generates Haxe externs for the classes, enums, virtuals
+// and natives of the module, one module per type laid out by package.
+// Static methods and variables are taken from the class object of a
+// class. Virtuals have no name in the module and become typedefs
+// VirtualN, N being their type index, of the module Virtuals. Natives
+// are grouped in one class per library in the natives package, along
+// with those of the library loaded on demand.
+// Types of the Haxe standard library and its natives are left out
+// unless std is set. Resolve must have been called beforehand.
+func (d *Data) HaxeExterns(std bool) []HaxeFile {
+	g := &haxeGen{d: d, index: make(map[hlType]int)}
+	classes := make(map[string]*ObjType)
+	statics := make(map[string]*ObjType)
+	enums := make(map[string]*EnumType)
+	for i, t := range d.types {
+		g.index[t] = i
+		switch t := t.(type) {
+		case *ObjType:
+			name := d.strings.String(t.nameIdx)
+			if strings.HasPrefix(name, "$") {
+				statics[name[1:]] = t
+			} else {
+				classes[name] = t
+			}
+		case *EnumType:
+			enums[d.strings.String(t.nameIdx)] = t
+		}
+	}
+	keep := func(name string) bool {
+		return haxePath(name) && (std || !isHaxeStd(name))
+	}
+
+	var res []HaxeFile
+	for name, o := range classes {
+		if keep(name) {
+			res = append(res, g.class(name, o, statics[name]))
+		}
+	}
+	for name, s := range statics {
+		if _, ok := classes[name]; !ok && enums[name] == nil && keep(name) {
+			res = append(res, g.class(name, nil, s))
+		}
+	}
+	for name, e := range enums {
+		if keep(name) {
+			res = append(res, g.enum(name, e))
+		}
+	}
+	libs := make(map[string][]*hlNative)
+	for _, n := range d.natives {
+		if std || n.libPtr != "std" {
+			name := nativesClass(n.libPtr)
+			libs[name] = append(libs[name], n)
+		}
+	}
+	for name, l := range libs {
+		sort.Slice(l, func(i, j int) bool {
+			if l[i].namePtr != l[j].namePtr {
+				return l[i].namePtr < l[j].namePtr
+			}
+			// Prefer the library loaded up front
+			li, lj := strings.HasPrefix(l[i].libPtr, "?"), strings.HasPrefix(l[j].libPtr, "?")
+			if li != lj {
+				return lj
+			}
+			return l[i].libPtr < l[j].libPtr
+		})
+		res = append(res, g.natives(name, l))
+	}
+	if f, ok := g.virtuals(); ok {
+		res = append(res, f)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Path < res[j].Path })
+	return res
+}
@@ -0,0 +1,116 @@
+package hashlink
+
+import (
+	"strings"
+	"testing"
+)
+
+// classModule encodes class A with a virtual method f and a method g,
+// and its subclass B redefining f and adding a method h. Natives open
+// and close come from library foo and its on demand form ?foo.
+func classModule() []byte {
+	var w hlbWriter
+	w.WriteString(Magic)
+	w.WriteByte(4)
+	w.index(0) // flags
+	w.index(0) // ints
+	w.index(0) // floats
+	w.index(9) // strings
+	w.index(4) // types
+	w.index(0) // globals
+	w.index(2) // natives
+	w.index(4) // functions
+	w.index(0) // constants
+	w.index(0) // entry point
+
+	var strs [][]byte
+	for _, s := range []string{"A", "f", "g", "B", "h", "foo", "?foo", "open", "close"} {
+		strs = append(strs, []byte(s))
+	}
+	w.stringBlock(strs)
+
+	w.WriteByte(byte(VoidT))
+	w.WriteByte(byte(FunT))
+	w.WriteByte(0)
+	w.index(0)
+	for _, c := range []struct {
+		name, super int
+		protos      [][3]int
+	}{
+		{0, -1, [][3]int{{1, 0, 0}, {2, 1, -1}}},
+		{3, 2, [][3]int{{1, 2, 0}, {4, 3, -1}}},
+	} {
+		w.WriteByte(byte(ObjT))
+		w.index(c.name)
+		w.index(c.super)
+		w.index(0)
+		w.index(0)
+		w.index(len(c.protos))
+		w.index(0)
+		for _, p := range c.protos {
+			for _, v := range p {
+				w.index(v)
+			}
+		}
+	}
+
+	for i, n := range [][2]int{{5, 7}, {6, 8}} {
+		w.index(n[0])
+		w.index(n[1])
+		w.index(1)
+		w.index(4 + i)
+	}
+	for fn := 0; fn < 4; fn++ {
+		w.index(1)
+		w.index(fn)
+		w.index(1)
+		w.index(1)
+		w.index(0)
+		w.WriteByte(byte(OpRet))
+		w.index(0)
+	}
+	return w.Bytes()
+}
+
+// haxeFile returns the source of the generated file at path
+func haxeFile(t *testing.T, files []HaxeFile, path string) string {
+	var res []string
+	for _, f := range files {
+		if f.Path == path {
+			res = append(res, f.Source)
+		}
+	}
+	if len(res) != 1 {
+		t.Fatalf("%d files %s", len(res), path)
+	}
+	return res[0]
+}
+
+// classExterns returns the externs of classModule
+func classExterns(t *testing.T) []HaxeFile {
+	d, err := NewData(classModule())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Resolve()
+	return d.HaxeExterns(false)
+}
+
+func TestHaxeOverride(t *testing.T) {
+	b := haxeFile(t, classExterns(t), "B.hx")
+	if !strings.Contains(b, "override function f") {
+		t.Errorf("B.f does not override A.f:\n%s", b)
+	}
+	if strings.Contains(b, "override function h") {
+		t.Errorf("B.h overrides:\n%s", b)
+	}
+}
+
+func TestHaxeNatives(t *testing.T) {
+	foo := haxeFile(t, classExterns(t), "natives/Foo.hx")
+	for _, s := range []string{`@:hlNative("foo", "open")`, `@:hlNative("?foo", "close")`} {
+		if !strings.Contains(foo, s) {
+			t.Errorf("no %s in natives:\n%s", s, foo)
+		}
+	}
+}
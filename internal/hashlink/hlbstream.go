@@ -1,7 +1,12 @@
 package hashlink
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/binary"
+	"io"
+	"math"
+	"os"
 )
 
 // Hashlink Byte Stream
@@ -28,12 +33,11 @@ func (b *hlbStream) int32() int32 {
 	return res
 }
 
-// Inconclusive how doubles are handled by Hashlib
+// Doubles are stored as raw little endian IEEE 754 values
 // For reference see hl_read_double()
 // https://github.com/HaxeFoundation/hashlink/blob/master/src/code.c
 func (b *hlbStream) float64() float64 {
-	var res float64
-	// FIXME
+	res := math.Float64frombits(binary.LittleEndian.Uint64(*b))
 	*b = (*b)[8:]
 	return res
 }
@@ -68,3 +72,350 @@ func (b *hlbStream) index() int {
 		return -i
 	}
 }
+
+// bytes returns the next n bytes and advances stream ptr
+func (b *hlbStream) bytes(n int) []byte {
+	res := (*b)[:n]
+	*b = (*b)[n:]
+	return res
+}
+
+// opReader is the part of a stream needed to decode instructions
+type opReader interface {
+	byte() byte
+	index() int
+}
+
+// stream is a source of encoded module data. Read errors are
+// sticky and reported by err, reads after an error return zero.
+type stream interface {
+	opReader
+	int32() int32
+	float64() float64
+	bytes(n int) []byte
+	skip(n int)
+	err() error
+
+	// fail records err as the read error unless there is one
+	fail(err error)
+
+	// pos returns the number of bytes read so far
+	pos() int
+
+	// left returns the number of bytes left to read, or -1 if
+	// it is not known
+	left() int
+
+	// record starts capturing the bytes read, recorded
+	// stops capturing and returns them.
+	record()
+	recorded() []byte
+}
+
+// sliceStream reads a module held in memory
+type sliceStream struct {
+	hlbStream
+	start hlbStream
+	size  int
+	e     error
+}
+
+func newSliceStream(b hlbStream) *sliceStream {
+	return &sliceStream{hlbStream: b, size: len(b)}
+}
+
+// short reports whether fewer than n bytes remain, failing the
+// stream if so. Reads after a failure return zero.
+func (s *sliceStream) short(n int) bool {
+	if s.e != nil {
+		return true
+	}
+	if n > len(s.hlbStream) {
+		s.e = io.ErrUnexpectedEOF
+		return true
+	}
+	return false
+}
+
+func (s *sliceStream) byte() byte {
+	if s.e != nil || len(s.hlbStream) == 0 {
+		s.short(1)
+		return 0
+	}
+	res := s.hlbStream[0]
+	s.hlbStream = s.hlbStream[1:]
+	return res
+}
+
+func (s *sliceStream) int32() int32 {
+	if s.short(4) {
+		return 0
+	}
+	return s.hlbStream.int32()
+}
+
+func (s *sliceStream) float64() float64 {
+	if s.short(8) {
+		return 0
+	}
+	return s.hlbStream.float64()
+}
+
+func (s *sliceStream) index() int {
+	if s.e == nil && len(s.hlbStream) >= 4 {
+		return s.hlbStream.index()
+	}
+	if s.short(1) {
+		return 0
+	}
+	n := 1
+	if c := s.hlbStream[0]; c&0xc0 == 0x80 {
+		n = 2
+	} else if c&0xc0 == 0xc0 {
+		n = 4
+	}
+	if s.short(n) {
+		return 0
+	}
+	return s.hlbStream.index()
+}
+
+func (s *sliceStream) bytes(n int) []byte {
+	if n < 0 || s.short(n) {
+		return nil
+	}
+	return s.hlbStream.bytes(n)
+}
+
+func (s *sliceStream) skip(n int) {
+	if n < 0 || s.short(n) {
+		return
+	}
+	s.hlbStream.skip(n)
+}
+
+func (s *sliceStream) pos() int { return s.size - len(s.hlbStream) }
+
+func (s *sliceStream) left() int { return len(s.hlbStream) }
+
+func (s *sliceStream) err() error { return s.e }
+
+func (s *sliceStream) fail(err error) {
+	if s.e == nil {
+		s.e = err
+	}
+}
+
+func (s *sliceStream) record() { s.start = s.hlbStream }
+
+// recorded returns the bytes read since record without copying
+func (s *sliceStream) recorded() []byte {
+	return s.start[:len(s.start)-len(s.hlbStream)]
+}
+
+// readerStream decodes a module incrementally from an io.Reader
+type readerStream struct {
+	r         *bufio.Reader
+	buf       [8]byte
+	rec       []byte
+	recording bool
+	n         int
+	size      int
+	e         error
+}
+
+func newReaderStream(r io.Reader) *readerStream {
+	s := &readerStream{size: readerSize(r)}
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReaderSize(r, 64*1024)
+	}
+	s.r = br
+	return s
+}
+
+// readerSize returns the number of bytes left in r, or -1 if it
+// cannot tell without reading them
+func readerSize(r io.Reader) int {
+	switch r := r.(type) {
+	case interface{ Len() int }:
+		return r.Len()
+	case *os.File:
+		fi, err := r.Stat()
+		if err != nil || !fi.Mode().IsRegular() {
+			return -1
+		}
+		off, err := r.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return -1
+		}
+		return int(fi.Size() - off)
+	}
+	return -1
+}
+
+func (s *readerStream) read(p []byte) {
+	if s.e == nil {
+		var n int
+		n, s.e = io.ReadFull(s.r, p)
+		s.n += n
+		if s.e == io.EOF {
+			s.e = io.ErrUnexpectedEOF
+		}
+	}
+	if s.e != nil {
+		for i := range p {
+			p[i] = 0
+		}
+		return
+	}
+	if s.recording {
+		s.rec = append(s.rec, p...)
+	}
+}
+
+func (s *readerStream) byte() byte {
+	s.read(s.buf[:1])
+	return s.buf[0]
+}
+
+func (s *readerStream) int32() int32 {
+	s.read(s.buf[:4])
+	return int32(binary.LittleEndian.Uint32(s.buf[:4]))
+}
+
+func (s *readerStream) float64() float64 {
+	s.read(s.buf[:8])
+	return math.Float64frombits(binary.LittleEndian.Uint64(s.buf[:8]))
+}
+
+// See hlbStream.index for a description of the encoding
+func (s *readerStream) index() int {
+	var i int
+	c := s.byte()
+
+	if c&0x80 == 0 {
+		return int(c)
+	}
+
+	if (c & 0x40) == 0 {
+		s.read(s.buf[1:2])
+		i = int(c&0x1f)<<8 | int(s.buf[1])
+	} else {
+		s.read(s.buf[1:4])
+		i = int(c&0x1f)<<24 | int(s.buf[1])<<16 | int(s.buf[2])<<8 | int(s.buf[3])
+	}
+
+	if (c & 0x20) == 0 {
+		return i
+	}
+	return -i
+}
+
+// Blobs are read in chunks of at most readChunk bytes so a corrupt
+// size can not allocate more than what the reader holds
+const readChunk = 1 << 20
+
+func (s *readerStream) bytes(n int) []byte {
+	if n < 0 || s.e != nil {
+		return nil
+	}
+	var res []byte
+	for len(res) < n && s.e == nil {
+		k := n - len(res)
+		if k > readChunk {
+			k = readChunk
+		}
+		res = append(res, make([]byte, k)...)
+		s.read(res[len(res)-k:])
+	}
+	if s.e != nil {
+		return nil
+	}
+	return res
+}
+
+func (s *readerStream) skip(n int) {
+	if n < 0 {
+		n = 0
+	}
+	if s.e != nil {
+		return
+	}
+	if s.recording {
+		s.bytes(n)
+		return
+	}
+	n, err := s.r.Discard(n)
+	s.n += n
+	if err != nil {
+		s.e = io.ErrUnexpectedEOF
+	}
+}
+
+func (s *readerStream) pos() int { return s.n }
+
+func (s *readerStream) left() int {
+	if s.size < 0 {
+		return -1
+	}
+	return s.size - s.n
+}
+
+func (s *readerStream) err() error { return s.e }
+
+func (s *readerStream) fail(err error) {
+	if s.e == nil {
+		s.e = err
+	}
+}
+
+func (s *readerStream) record() {
+	s.rec = nil
+	s.recording = true
+}
+
+func (s *readerStream) recorded() []byte {
+	res := s.rec
+	s.rec = nil
+	s.recording = false
+	return res
+}
+
+// hlbWriter encodes module data in the HLB format
+type hlbWriter struct {
+	bytes.Buffer
+}
+
+// index encodes i using the 1, 2 or 4 byte index encoding
+func (w *hlbWriter) index(i int) {
+	var sign byte
+	if i < 0 {
+		sign = 0x20
+		i = -i
+	}
+	switch {
+	case sign == 0 && i < 0x80:
+		w.WriteByte(byte(i))
+	case i < 0x2000:
+		w.WriteByte(0x80 | sign | byte(i>>8))
+		w.WriteByte(byte(i))
+	default:
+		w.WriteByte(0xc0 | sign | byte(i>>24))
+		w.WriteByte(byte(i >> 16))
+		w.WriteByte(byte(i >> 8))
+		w.WriteByte(byte(i))
+	}
+}
+
+func (w *hlbWriter) int32(i int32) {
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], uint32(i))
+	w.Write(b[:])
+}
+
+func (w *hlbWriter) float64(f float64) {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], math.Float64bits(f))
+	w.Write(b[:])
+}
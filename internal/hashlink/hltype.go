@@ -1,5 +1,9 @@
 package hashlink
 
+import (
+	"sync"
+)
+
 func (id HdtId) NewType() hlType {
 	var t hlType
 
@@ -44,6 +48,12 @@ func (id HdtId) NewType() hlType {
 		t = new(EnumType)
 	case NullT:
 		t = new(NullType)
+	case MethodT:
+		t = &FunType{method: true}
+	case StructT:
+		t = &ObjType{structure: true}
+	case PackedT:
+		t = &RefType{packed: true}
 	}
 
 	return t
@@ -113,7 +123,10 @@ func (t *DynType) Id() HdtId {
 	return DynT
 }
 
+// FunType is a function type. Method types share its encoding and
+// are only told apart by their id.
 type FunType struct {
+	method bool
 	argIdx []int
 	retIdx int
 	argPtr []hlType
@@ -138,10 +151,13 @@ type FunType struct {
 }
 
 func (t *FunType) Id() HdtId {
+	if t.method {
+		return MethodT
+	}
 	return FunT
 }
 
-func (t *FunType) Unmarshal(ctx *Data, b *hlbStream) {
+func (t *FunType) Unmarshal(ctx *Data, b stream) {
 	nArg := int(b.byte())
 	t.argIdx = make([]int, nArg)
 	for i := 0; i < nArg; i++ {
@@ -150,34 +166,43 @@ func (t *FunType) Unmarshal(ctx *Data, b *hlbStream) {
 	t.retIdx = b.index()
 }
 
+// ObjType is a class. Struct types share its encoding and are only
+// told apart by their id.
 type ObjType struct {
-	nameIdx  int
-	namePtr  []byte
-	superIdx int
-	superPtr *ObjType
-	global   int
-	offset   int
-	lField   []hlField
-	lProto   []hlProto
-	lBinding []hlBinding
+	structure bool
+	nameIdx   int
+	namePtr   []byte
+	superIdx  int
+	superPtr  *ObjType
+	global    int
+	offset    int
+	lField    []hlField
+	lProto    []hlProto
+	lBinding  []hlBinding
 }
 
 func (t *ObjType) Id() HdtId {
+	if t.structure {
+		return StructT
+	}
 	return ObjT
 }
 
-func (t *ObjType) Unmarshal(ctx *Data, b *hlbStream) {
+func (t *ObjType) Unmarshal(ctx *Data, b stream) {
 	t.nameIdx = b.index()
 	t.superIdx = b.index()
 	t.global = b.index()
-	nField := b.index()
-	nProto := b.index()
-	nBinding := b.index()
+	nField := count(b)
+	nProto := count(b)
+	nBinding := count(b)
 
 	if t.superIdx > 0 {
-		super := ctx.LookupType(t.superIdx).(*ObjType)
+		super, ok := ctx.LookupType(t.superIdx).(*ObjType)
+		if !ok {
+			b.fail(ErrCorrupt)
+			return
+		}
 		t.offset = super.offset + len(super.lField)
-		t.offset += len(t.lField)
 	}
 
 	t.lField = make([]hlField, nField)
@@ -199,6 +224,30 @@ func (t *ObjType) Unmarshal(ctx *Data, b *hlbStream) {
 	}
 }
 
+// field returns the field at runtime index i, walking the
+// super class chain for inherited fields.
+func (t *ObjType) field(i int) *hlField {
+	if i < t.offset {
+		if t.superPtr == nil {
+			return nil
+		}
+		return t.superPtr.field(i)
+	}
+	i -= t.offset
+	if i >= len(t.lField) {
+		return nil
+	}
+	return &t.lField[i]
+}
+
+// fields returns all runtime fields including inherited ones
+func (t *ObjType) fields() []hlField {
+	if t.superPtr == nil {
+		return t.lField
+	}
+	return append(t.superPtr.fields(), t.lField...)
+}
+
 type ArrayType struct {
 }
 
@@ -213,15 +262,23 @@ func (t *TypeType) Id() HdtId {
 	return TypeT
 }
 
+// RefType is a reference to a value. Packed types, a struct stored
+// inline rather than by pointer, share its encoding and are only told
+// apart by their id.
 type RefType struct {
+	packed   bool
 	paramIdx int
+	paramPtr hlType
 }
 
 func (t *RefType) Id() HdtId {
+	if t.packed {
+		return PackedT
+	}
 	return RefT
 }
 
-func (t *RefType) Unmarshal(ctx *Data, b *hlbStream) {
+func (t *RefType) Unmarshal(ctx *Data, b stream) {
 	t.paramIdx = b.index()
 }
 
@@ -241,8 +298,8 @@ func (t *VirtualType) Id() HdtId {
 	return VirtualT
 }
 
-func (t *VirtualType) Unmarshal(ctx *Data, b *hlbStream) {
-	nField := b.index()
+func (t *VirtualType) Unmarshal(ctx *Data, b stream) {
+	nField := count(b)
 	t.field = make([]hlField, nField)
 	for i := 0; i < nField; i++ {
 		t.field[i].nameIdx = b.index()
@@ -267,7 +324,7 @@ func (t *AbstractType) Id() HdtId {
 	return AbstractT
 }
 
-func (t *AbstractType) Unmarshal(ctx *Data, b *hlbStream) {
+func (t *AbstractType) Unmarshal(ctx *Data, b stream) {
 	t.nameIdx = b.index()
 }
 
@@ -282,14 +339,14 @@ func (t *EnumType) Id() HdtId {
 	return EnumT
 }
 
-func (t *EnumType) Unmarshal(ctx *Data, b *hlbStream) {
+func (t *EnumType) Unmarshal(ctx *Data, b stream) {
 	t.nameIdx = b.index()
 	t.globalValue = b.index()
 	nConstruct := int(b.byte())
 	t.lConstruct = make([]hlEnumConstruct, nConstruct)
 	for i := 0; i < nConstruct; i++ {
 		t.lConstruct[i].nameIdx = b.index()
-		nParam := b.index()
+		nParam := count(b)
 		t.lConstruct[i].argIdx = make([]int, nParam)
 		for j := 0; j < nParam; j++ {
 			t.lConstruct[i].argIdx[j] = b.index()
@@ -299,13 +356,14 @@ func (t *EnumType) Unmarshal(ctx *Data, b *hlbStream) {
 
 type NullType struct {
 	paramIdx int
+	paramPtr hlType
 }
 
 func (t *NullType) Id() HdtId {
 	return NullT
 }
 
-func (t *NullType) Unmarshal(ctx *Data, b *hlbStream) {
+func (t *NullType) Unmarshal(ctx *Data, b stream) {
 	t.paramIdx = b.index()
 }
 
@@ -339,6 +397,41 @@ type hlEnumConstruct struct {
 	argIdx  []int
 }
 
+type hlConstant struct {
+	globalIdx int
+	fields    []int
+}
+
+// hlPos is the debug file index and line of an instruction
+type hlPos struct {
+	file int32
+	line int32
+}
+
+// hlAssign names a local variable for the debugger. Pos is the
+// instruction assigning it, or -1-n for argument n.
+type hlAssign struct {
+	nameIdx int
+	pos     int
+}
+
+// assignReg returns the register named by debug assignment a, which
+// is the argument register or the one written at its position, or -1.
+func (f *hlFunction) assignReg(a hlAssign) int {
+	r := -1 - a.pos
+	if a.pos >= 0 {
+		code := f.code()
+		if a.pos >= len(code) {
+			return -1
+		}
+		r, _ = code[a.pos].defUse(nil)
+	}
+	if r < 0 || r >= len(f.regIdx) {
+		return -1
+	}
+	return r
+}
+
 type Function interface{}
 
 type hlNative struct {
@@ -358,11 +451,64 @@ type hlFunction struct {
 	funcIdx int
 	funcPtr int
 	regIdx  []int
+	nInst   int
 	inst    []HilInst
+	arena   []int
+	body    hlbStream
+	once    sync.Once
+	pos     []hlPos
+	debug   hlbStream
+	posOnce sync.Once
+	assigns []hlAssign
+	err     error
 	obj     hlType
 	field   []byte
 }
 
+// code returns the instructions of f. Functions read with
+// Options.LazyCode are decoded on first use. The encoded body
+// holds the instructions followed by any debug information. A body
+// failing to decode keeps the instructions preceding the error,
+// which is recorded in err.
+func (f *hlFunction) code() []HilInst {
+	f.once.Do(func() {
+		if f.body == nil {
+			return
+		}
+		b := f.body
+		f.inst = make([]HilInst, f.nInst)
+		f.arena = make([]int, 0, arenaHint*f.nInst)
+		for i := range f.inst {
+			if f.err = readInstruction(&b, &f.inst[i], &f.arena); f.err != nil {
+				f.inst = f.inst[:i]
+				f.body = nil
+				return
+			}
+		}
+		if len(b) > 0 {
+			f.debug = b
+		}
+		f.body = nil
+	})
+	return f.inst
+}
+
+// positions returns the source position of every instruction of f,
+// or nil for modules without debug information.
+func (f *hlFunction) positions() []hlPos {
+	f.code()
+	f.posOnce.Do(func() {
+		if f.debug == nil {
+			return
+		}
+		b := f.debug
+		f.pos = make([]hlPos, f.nInst)
+		readDebugInfo(&b, f.nInst, f.pos)
+		f.debug = nil
+	})
+	return f.pos
+}
+
 type Flags int
 
 func (f Flags) HasDebug() bool { return f&1 == 1 }
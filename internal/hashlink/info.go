@@ -0,0 +1,99 @@
+package hashlink
+
+import (
+	"sort"
+)
+
+// FunctionSize is the size of a bytecode function
+type FunctionSize struct {
+	FuncRef
+	Instructions int `json:"instructions"`
+	Registers    int `json:"registers"`
+}
+
+// OpCount is the number of occurrences of an opcode
+type OpCount struct {
+	Op    string `json:"op"`
+	Count int    `json:"count"`
+}
+
+// Info summarizes the header and contents of a module
+type Info struct {
+	Version      int            `json:"version"`
+	Flags        int            `json:"flags"`
+	Debug        bool           `json:"debug"`
+	DebugFiles   int            `json:"debugFiles"`
+	EntryPoint   FuncRef        `json:"entryPoint"`
+	Ints         int            `json:"ints"`
+	Floats       int            `json:"floats"`
+	Strings      int            `json:"strings"`
+	Bytes        int            `json:"bytes"`
+	Types        int            `json:"types"`
+	Globals      int            `json:"globals"`
+	Natives      int            `json:"natives"`
+	Functions    int            `json:"functions"`
+	Constants    int            `json:"constants"`
+	Sections     []Section      `json:"sections"`
+	Instructions int            `json:"instructions"`
+	Largest      []FunctionSize `json:"largest"`
+	Opcodes      []OpCount      `json:"opcodes"`
+}
+
+// Info summarizes the module, listing the top largest functions by
+// instruction count. Resolve must have been called beforehand.
+func (d *Data) Info(top int) *Info {
+	info := &Info{
+		Version:    d.version,
+		Flags:      int(d.flags),
+		Debug:      d.flags.HasDebug(),
+		DebugFiles: len(d.debugFiles),
+		EntryPoint: FuncRef{d.entryPoint, d.FunctionName(d.entryPoint)},
+		Ints:       len(d.ints),
+		Floats:     len(d.floats),
+		Strings:    d.strings.Len(),
+		Bytes:      d.bytes.Len(),
+		Types:      len(d.types),
+		Globals:    len(d.globals),
+		Natives:    len(d.natives),
+		Functions:  len(d.functions),
+		Constants:  len(d.constants),
+		Sections:   d.sections,
+	}
+
+	sizes := make([]FunctionSize, len(d.functions))
+	for i, f := range d.functions {
+		sizes[i] = FunctionSize{FuncRef{f.funcIdx, d.FunctionName(f.funcIdx)}, f.nInst, len(f.regIdx)}
+		info.Instructions += f.nInst
+	}
+	sort.SliceStable(sizes, func(i, j int) bool { return sizes[i].Instructions > sizes[j].Instructions })
+	if top < 0 {
+		top = 0
+	}
+	if top < len(sizes) {
+		sizes = sizes[:top]
+	}
+	info.Largest = sizes
+
+	info.Opcodes = d.opcodeHistogram(d.functions)
+	return info
+}
+
+// opcodeHistogram counts the opcodes used by fns, most frequent first
+func (d *Data) opcodeHistogram(fns []*hlFunction) []OpCount {
+	counts := make([]int, len(OpCodes))
+	for _, f := range fns {
+		code := f.code()
+		for i := range code {
+			counts[code[i].op]++
+		}
+	}
+
+	var res []OpCount
+	for op, n := range counts {
+		if n > 0 {
+			res = append(res, OpCount{HilOp(op).String(), n})
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool { return res[i].Count > res[j].Count })
+	return res
+}
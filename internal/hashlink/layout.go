@@ -0,0 +1,163 @@
+package hashlink
+
+import (
+	"strconv"
+	"strings"
+)
+
+// typeSize returns the number of bytes a value of type t occupies in
+// an object, as laid out by the HashLink runtime for pointers of ptr
+// bytes. Anything but a number is stored as a pointer.
+func typeSize(t hlType, ptr int) int {
+	switch t.(type) {
+	case *VoidType:
+		return 0
+	case *UI8Type, *BoolType:
+		return 1
+	case *UI16Type:
+		return 2
+	case *I32Type, *F32Type:
+		return 4
+	case *I64Type, *F64Type:
+		return 8
+	}
+	return ptr
+}
+
+// pad returns the padding inserted before a value of size bytes at
+// offset off, aligning numbers to their size
+func pad(off, size int) int {
+	if size == 0 {
+		return 0
+	}
+	return -off & (size - 1)
+}
+
+// FieldLayout is a field at a fixed offset in a runtime object
+type FieldLayout struct {
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	TypeIndex int    `json:"typeIndex"`
+	Offset    int    `json:"offset"`
+	Size      int    `json:"size"`
+}
+
+// StructLayout is the memory layout of instances of a class. Objects
+// start with a pointer to their runtime type, followed by the fields
+// of the class hierarchy from the root class down.
+type StructLayout struct {
+	Type   int           `json:"type"`
+	Name   string        `json:"name"`
+	Super  int           `json:"super,omitempty"`
+	Size   int           `json:"size"`
+	Fields []FieldLayout `json:"fields"`
+}
+
+// ConstructLayout is the memory layout of the values of an enum
+// constructor. Values start with a pointer to their runtime type and
+// the constructor index, followed by the constructor arguments.
+type ConstructLayout struct {
+	Name   string        `json:"name"`
+	Index  int           `json:"index"`
+	Size   int           `json:"size"`
+	Fields []FieldLayout `json:"fields,omitempty"`
+}
+
+// EnumLayout lists the constructors of an enum
+type EnumLayout struct {
+	Type       int               `json:"type"`
+	Name       string            `json:"name"`
+	Constructs []ConstructLayout `json:"constructs"`
+}
+
+// layout appends fields of types typeIdx to l from offset off,
+// returning the offset following the last one
+func (d *Data) layout(l []FieldLayout, off int, names []string, typeIdx []int, ptr int) ([]FieldLayout, int) {
+	for i, ti := range typeIdx {
+		t := d.LookupType(ti)
+		size := typeSize(t, ptr)
+		off += pad(off, size)
+		l = append(l, FieldLayout{names[i], d.TypeName(t), ti, off, size})
+		off += size
+	}
+	return l, off
+}
+
+// ObjLayout returns the layout of instances of class type t for
+// pointers of ptr bytes
+func (d *Data) ObjLayout(t int, ptr int) (StructLayout, bool) {
+	o, ok := d.LookupType(t).(*ObjType)
+	if !ok {
+		return StructLayout{}, false
+	}
+	s := StructLayout{Type: t, Name: d.TypeName(o), Size: ptr}
+	if o.superPtr != nil {
+		s.Super = o.superIdx
+	}
+	var chain []*ObjType
+	for c := o; c != nil; c = c.superPtr {
+		chain = append([]*ObjType{c}, chain...)
+	}
+	for _, c := range chain {
+		names := make([]string, len(c.lField))
+		types := make([]int, len(c.lField))
+		for i, f := range c.lField {
+			names[i] = d.strings.String(f.nameIdx)
+			types[i] = f.typeIdx
+		}
+		s.Fields, s.Size = d.layout(s.Fields, s.Size, names, types, ptr)
+	}
+	return s, true
+}
+
+// EnumLayout returns the constructors of enum type t with the layout
+// of their values for pointers of ptr bytes. Constructor arguments are
+// unnamed in the module and named pN after their position.
+func (d *Data) EnumLayout(t int, ptr int) (EnumLayout, bool) {
+	e, ok := d.LookupType(t).(*EnumType)
+	if !ok {
+		return EnumLayout{}, false
+	}
+	res := EnumLayout{Type: t, Name: d.TypeName(e)}
+	// venum is a type pointer and an int, arguments follow aligned
+	// to their own size
+	header := ptr + 4
+	for i, c := range e.lConstruct {
+		names := make([]string, len(c.argIdx))
+		for j := range names {
+			names[j] = "p" + strconv.Itoa(j)
+		}
+		cl := ConstructLayout{Name: d.strings.String(c.nameIdx), Index: i}
+		cl.Fields, cl.Size = d.layout(nil, header, names, c.argIdx, ptr)
+		res.Constructs = append(res.Constructs, cl)
+	}
+	return res, true
+}
+
+// NativeSymbol returns the C name of the function implementing native
+// lib.name: hl_name for the standard library and lib_name otherwise.
+// A leading ? marks a library loaded on demand and is not part of it.
+func NativeSymbol(lib, name string) string {
+	lib = strings.TrimPrefix(lib, "?")
+	if lib == "std" {
+		lib = "hl"
+	}
+	return lib + "_" + name
+}
+
+// CFunctionName returns the name the HL/C code generator gives function
+// i: Class_method for methods, with the dots of the class path and the
+// $ of static classes dropped, and fun$i for anything else. Natives
+// are named as by NativeSymbol.
+func (d *Data) CFunctionName(i int) string {
+	switch f := d.LookupFunction(i).(type) {
+	case *hlNative:
+		return NativeSymbol(f.libPtr, f.namePtr)
+	case *hlFunction:
+		if t, ok := f.obj.(*ObjType); ok {
+			class := strings.TrimPrefix(d.strings.String(t.nameIdx), "$")
+			return strings.Replace(class, ".", "_", -1) + "_" + string(f.field)
+		}
+	}
+	return "fun$" + strconv.Itoa(i)
+}
@@ -0,0 +1,54 @@
+package hashlink
+
+import "testing"
+
+// enumModule encodes a module of enum E { A(i32); B(f64); }
+func enumModule() []byte {
+	var w hlbWriter
+	w.WriteString(Magic)
+	w.WriteByte(4)
+	w.index(0) // flags
+	w.index(0) // ints
+	w.index(0) // floats
+	w.index(3) // strings
+	w.index(3) // types
+	w.index(0) // globals
+	w.index(0) // natives
+	w.index(0) // functions
+	w.index(0) // constants
+	w.index(0) // entry point
+
+	w.stringBlock([][]byte{[]byte("E"), []byte("A"), []byte("B")})
+
+	w.WriteByte(byte(I32T))
+	w.WriteByte(byte(F64T))
+	w.WriteByte(byte(EnumT))
+	w.index(0)
+	w.index(0)
+	w.WriteByte(2)
+	for i := 0; i < 2; i++ {
+		w.index(1 + i)
+		w.index(1)
+		w.index(i)
+	}
+	return w.Bytes()
+}
+
+func TestEnumLayout(t *testing.T) {
+	d, err := NewData(enumModule())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Resolve()
+	for ptr, want := range map[int][]int{4: {8, 8}, 8: {12, 16}} {
+		l, ok := d.EnumLayout(2, ptr)
+		if !ok || len(l.Constructs) != 2 {
+			t.Fatalf("layout %+v, %v", l, ok)
+		}
+		for i, c := range l.Constructs {
+			if off := c.Fields[0].Offset; off != want[i] {
+				t.Errorf("%d bit %s argument at %d, want %d", ptr*8, c.Name, off, want[i])
+			}
+		}
+	}
+}
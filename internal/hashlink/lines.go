@@ -0,0 +1,85 @@
+package hashlink
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Position is a location in the Haxe source
+type Position struct {
+	File string `json:"file"`
+	Line int    `json:"line"`
+}
+
+func (p Position) String() string {
+	return p.File + ":" + strconv.Itoa(p.Line)
+}
+
+// LineRange is a run of consecutive instructions of a function
+// generated from a single source line. Start and End are inclusive.
+type LineRange struct {
+	FuncRef
+	Start int `json:"start"`
+	End   int `json:"end"`
+	Position
+}
+
+// debugFile returns the name of debug file i
+func (d *Data) debugFile(i int) string {
+	if i < 0 || i >= len(d.debugFiles) {
+		return "?"
+	}
+	return string(d.debugFiles[i])
+}
+
+// Position returns the source position of instruction pc of function
+// fn. It fails if fn is not a bytecode function, pc is out of range
+// or the module lacks debug information.
+func (d *Data) Position(fn, pc int) (Position, bool) {
+	f, ok := d.LookupFunction(fn).(*hlFunction)
+	if !ok {
+		return Position{}, false
+	}
+	pos := f.positions()
+	if pc < 0 || pc >= len(pos) {
+		return Position{}, false
+	}
+	return Position{d.debugFile(int(pos[pc].file)), int(pos[pc].line)}, true
+}
+
+// sameFile reports whether debug file name refers to file. A file
+// given without directories matches any directory.
+func sameFile(name, file string) bool {
+	return name == file || strings.HasSuffix(name, "/"+file)
+}
+
+// FindLine returns the instruction ranges generated from line of file,
+// in function order. A line of 0 matches every line of the file.
+func (d *Data) FindLine(file string, line int) []LineRange {
+	files := make([]bool, len(d.debugFiles))
+	for i, name := range d.debugFiles {
+		files[i] = sameFile(string(name), file)
+	}
+
+	var res []LineRange
+	for _, f := range d.functions {
+		pos := f.positions()
+		for pc := 0; pc < len(pos); pc++ {
+			p := pos[pc]
+			if p.file < 0 || int(p.file) >= len(files) || !files[p.file] || (line != 0 && int(p.line) != line) {
+				continue
+			}
+			r := LineRange{
+				FuncRef:  FuncRef{f.funcIdx, d.FunctionName(f.funcIdx)},
+				Start:    pc,
+				Position: Position{d.debugFile(int(p.file)), int(p.line)},
+			}
+			for pc+1 < len(pos) && pos[pc+1] == p {
+				pc++
+			}
+			r.End = pc
+			res = append(res, r)
+		}
+	}
+	return res
+}
@@ -0,0 +1,99 @@
+package hashlink
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Line is a line of a function listing: an instruction, or with a PC
+// of -1 the start or end of a try region.
+type Line struct {
+	PC    int       `json:"pc"`
+	Text  string    `json:"text"`
+	Note  string    `json:"note,omitempty"`
+	Calls []FuncRef `json:"calls,omitempty"`
+}
+
+// Listing returns the instructions of function fn annotated with try
+// regions, dead stores, the callees of indirect calls and constant
+// arguments, or nil if fn is not a bytecode function. Calls lists the
+// possible callees of each call site.
+func (d *Data) Listing(fn int) []Line {
+	return d.LinkedListing(fn, noLink)
+}
+
+// LinkedListing is Listing with the operands of instructions formatted
+// by link
+func (d *Data) LinkedListing(fn int, link LinkFunc) []Line {
+	f, ok := d.LookupFunction(fn).(*hlFunction)
+	if !ok {
+		return nil
+	}
+	return d.funcListing(f, link)
+}
+
+func (d *Data) funcListing(f *hlFunction, link LinkFunc) []Line {
+	an := d.analyze(f)
+	notes := d.constNotes(f, an)
+	sites := make(map[int]*CallSite)
+	for _, s := range d.callSites(f, an) {
+		s := s
+		sites[s.PC] = &s
+	}
+	try := an.Graph.Try
+
+	var res []Line
+	for j := range f.code() {
+		for _, r := range try {
+			if r.Start == j && r.End >= r.Start {
+				res = append(res, Line{PC: -1, Text: "try {"})
+			}
+		}
+		l := Line{PC: j, Text: d.formatInst(f, j, fmtTyped, link)}
+		var note []string
+		if an.DeadStore(j) {
+			note = append(note, "dead store")
+		}
+		if s := sites[j]; s != nil {
+			l.Calls = s.Targets
+			if s.Kind != CallDirect {
+				note = append(note, s.TargetList())
+			}
+		}
+		if n, ok := notes[j]; ok {
+			note = append(note, n)
+		}
+		l.Note = strings.Join(note, " ; ")
+		res = append(res, l)
+		for k := len(try) - 1; k >= 0; k-- {
+			if r := try[k]; r.End == j && r.End >= r.Start {
+				res = append(res, Line{PC: -1, Text: fmt.Sprintf("} catch(%s) @%d", link(Entity{EntityNone, 0}, d.regName(f, r.Reg)), r.Handler)})
+			}
+		}
+	}
+	return res
+}
+
+// References maps the types, functions, globals and pool entries named
+// by instructions to the functions naming them, each listed once in
+// function order. Types are named by OpType and OpNew and functions by
+// direct calls and closures. Resolve must have been called beforehand.
+func (d *Data) References() map[Entity][]FuncRef {
+	res := make(map[Entity][]FuncRef)
+	for _, f := range d.functions {
+		ref := FuncRef{f.funcIdx, d.FunctionName(f.funcIdx)}
+		collect := func(e Entity, text string) string {
+			if e.Kind != EntityNone {
+				l := res[e]
+				if n := len(l); n == 0 || l[n-1].Index != ref.Index {
+					res[e] = append(l, ref)
+				}
+			}
+			return text
+		}
+		for pc := range f.code() {
+			d.formatInst(f, pc, 0, collect)
+		}
+	}
+	return res
+}
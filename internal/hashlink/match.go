@@ -0,0 +1,325 @@
+package hashlink
+
+import (
+	"hash/fnv"
+	"sort"
+	"strings"
+)
+
+// Fingerprint is a structural summary of a function that does not
+// depend on the index numbering of a particular build.
+type Fingerprint struct {
+	Shape   string   `json:"shape"`
+	Ops     []HilOp  `json:"-"`
+	Natives []string `json:"natives,omitempty"`
+	Strings []string `json:"strings,omitempty"`
+	Hash    uint64   `json:"hash"`
+
+	grams map[uint32]int
+}
+
+// Match pairs a function of one build with a function of another
+type Match struct {
+	Old   FuncRef `json:"old"`
+	New   FuncRef `json:"new"`
+	Score float64 `json:"score"`
+}
+
+// Matches scoring below this are discarded
+const minMatchScore = 0.5
+
+// Relative weight of each fingerprint component when scoring
+const (
+	weightShape   = 0.1
+	weightOps     = 0.5
+	weightNatives = 0.2
+	weightStrings = 0.2
+)
+
+// shape describes a function type by the kinds of its arguments
+// and return value only, as class names may differ between builds.
+func (d *Data) shape(t hlType) string {
+	ft, ok := t.(*FunType)
+	if !ok {
+		return "?"
+	}
+	args := make([]string, len(ft.argIdx))
+	for i := range ft.argIdx {
+		args[i] = d.kindName(ft.argIdx[i])
+	}
+	return "(" + strings.Join(args, ",") + ")" + d.kindName(ft.retIdx)
+}
+
+func (d *Data) kindName(i int) string {
+	t := d.LookupType(i)
+	if t == nil {
+		return "?"
+	}
+	return t.Id().String()
+}
+
+// fingerprint computes the structural fingerprint of function f
+func (d *Data) fingerprint(f *hlFunction) *Fingerprint {
+	code := f.code()
+	fp := &Fingerprint{
+		Shape: d.shape(d.LookupType(f.typeIdx)),
+		Ops:   make([]HilOp, len(code)),
+	}
+
+	natives := make(map[string]bool)
+	strs := make(map[string]bool)
+	for i := range code {
+		o := &code[i]
+		fp.Ops[i] = o.op
+		if tgt, ok := o.directCall(); ok {
+			if n, ok := d.LookupFunction(tgt).(*hlNative); ok {
+				natives[n.libPtr+"."+n.namePtr] = true
+			}
+		}
+		if o.op == OpString {
+			strs[d.strings.String(o.args()[1])] = true
+		}
+	}
+	fp.Natives = sortedKeys(natives)
+	fp.Strings = sortedKeys(strs)
+
+	h := fnv.New64a()
+	h.Write([]byte(fp.Shape))
+	for _, op := range fp.Ops {
+		h.Write([]byte{byte(op)})
+	}
+	for _, s := range fp.Natives {
+		h.Write([]byte{0})
+		h.Write([]byte(s))
+	}
+	for _, s := range fp.Strings {
+		h.Write([]byte{1})
+		h.Write([]byte(s))
+	}
+	fp.Hash = h.Sum64()
+
+	fp.grams = make(map[uint32]int)
+	for i := 0; i+2 < len(fp.Ops); i++ {
+		fp.grams[uint32(fp.Ops[i])<<16|uint32(fp.Ops[i+1])<<8|uint32(fp.Ops[i+2])]++
+	}
+	return fp
+}
+
+func sortedKeys(m map[string]bool) []string {
+	res := make([]string, 0, len(m))
+	for k := range m {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// Similarity scores two fingerprints between 0 and 1. Natives and
+// strings are left out of the score when neither function uses any, as
+// having none in common says nothing of the code.
+func (fp *Fingerprint) Similarity(o *Fingerprint) float64 {
+	if fp.Hash == o.Hash {
+		return 1
+	}
+	var score float64
+	if fp.Shape == o.Shape {
+		score += weightShape
+	}
+	score += weightOps * gramSimilarity(fp, o)
+	total := weightShape + weightOps
+	if len(fp.Natives) > 0 || len(o.Natives) > 0 {
+		score += weightNatives * jaccard(fp.Natives, o.Natives)
+		total += weightNatives
+	}
+	if len(fp.Strings) > 0 || len(o.Strings) > 0 {
+		score += weightStrings * jaccard(fp.Strings, o.Strings)
+		total += weightStrings
+	}
+	return score / total
+}
+
+// gramSimilarity is the weighted Jaccard index of the opcode trigrams.
+// Functions too short to form a trigram compare their opcodes directly.
+func gramSimilarity(a, b *Fingerprint) float64 {
+	if len(a.grams) == 0 || len(b.grams) == 0 {
+		if len(a.Ops) != len(b.Ops) {
+			return 0
+		}
+		for i := range a.Ops {
+			if a.Ops[i] != b.Ops[i] {
+				return 0
+			}
+		}
+		return 1
+	}
+	var min, max int
+	for g, ca := range a.grams {
+		cb := b.grams[g]
+		if ca < cb {
+			min += ca
+			max += cb
+		} else {
+			min += cb
+			max += ca
+		}
+	}
+	for g, cb := range b.grams {
+		if _, ok := a.grams[g]; !ok {
+			max += cb
+		}
+	}
+	return float64(min) / float64(max)
+}
+
+// jaccard compares two sorted string sets, at least one of which is
+// not empty
+func jaccard(a, b []string) float64 {
+	var common int
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] == b[j]:
+			common++
+			i++
+			j++
+		case a[i] < b[j]:
+			i++
+		default:
+			j++
+		}
+	}
+	return float64(common) / float64(len(a)+len(b)-common)
+}
+
+// Candidates are only scored against functions of similar size
+const matchSizeRatio = 0.5
+
+// MatchFunctions maps the bytecode functions of build a to those of
+// build b. Identical fingerprints are paired first: a fingerprint
+// found once in each build is a certain match, functions sharing a
+// fingerprint with others are paired by name, then in index order with
+// a score lowered by the number of candidates. The remaining functions
+// are paired greedily by descending similarity. Each function is used
+// at most once. The result is sorted by old index.
+func MatchFunctions(a, b *Data) []Match {
+	fa := make([]*Fingerprint, len(a.functions))
+	for i, f := range a.functions {
+		fa[i] = a.fingerprint(f)
+	}
+	fb := make([]*Fingerprint, len(b.functions))
+	for i, f := range b.functions {
+		fb[i] = b.fingerprint(f)
+	}
+
+	type pair struct {
+		i, j  int
+		score float64
+		exact bool
+	}
+	var pairs []pair
+
+	// Exact matches
+	hashA := make(map[uint64][]int)
+	for i := range fa {
+		hashA[fa[i].Hash] = append(hashA[fa[i].Hash], i)
+	}
+	hashB := make(map[uint64][]int)
+	for j := range fb {
+		hashB[fb[j].Hash] = append(hashB[fb[j].Hash], j)
+	}
+	for i := range fa {
+		la, lb := hashA[fa[i].Hash], hashB[fa[i].Hash]
+		if la[0] != i || len(lb) == 0 {
+			// Buckets are handled once, at their first function
+			continue
+		}
+		if len(la) == 1 && len(lb) == 1 {
+			pairs = append(pairs, pair{i, lb[0], 1, true})
+			continue
+		}
+		byName := make(map[string]int)
+		for _, j := range lb {
+			if name, ok := b.stableName(b.functions[j]); ok {
+				byName[name] = j
+			}
+		}
+		paired := make(map[int]bool)
+		var rest []int
+		for _, i := range la {
+			name, ok := a.stableName(a.functions[i])
+			if j, found := byName[name]; ok && found && !paired[j] {
+				paired[j] = true
+				pairs = append(pairs, pair{i, j, 1, true})
+				continue
+			}
+			rest = append(rest, i)
+		}
+		var restB []int
+		for _, j := range lb {
+			if !paired[j] {
+				restB = append(restB, j)
+			}
+		}
+		n := len(rest)
+		if len(restB) > n {
+			n = len(restB)
+		}
+		for k := 0; k < len(rest) && k < len(restB); k++ {
+			pairs = append(pairs, pair{rest[k], restB[k], 1 / float64(n), true})
+		}
+	}
+
+	// Approximate matches between functions of the same shape
+	byShape := make(map[string][]int)
+	for j := range fb {
+		byShape[fb[j].Shape] = append(byShape[fb[j].Shape], j)
+	}
+	for i := range fa {
+		for _, j := range byShape[fa[i].Shape] {
+			if fa[i].Hash == fb[j].Hash || !similarSize(len(fa[i].Ops), len(fb[j].Ops)) {
+				continue
+			}
+			if s := fa[i].Similarity(fb[j]); s >= minMatchScore {
+				pairs = append(pairs, pair{i, j, s, false})
+			}
+		}
+	}
+
+	sort.SliceStable(pairs, func(x, y int) bool {
+		if pairs[x].exact != pairs[y].exact {
+			return pairs[x].exact
+		}
+		return pairs[x].score > pairs[y].score
+	})
+	usedA := make([]bool, len(fa))
+	usedB := make([]bool, len(fb))
+	var res []Match
+	for _, p := range pairs {
+		if usedA[p.i] || usedB[p.j] {
+			continue
+		}
+		usedA[p.i], usedB[p.j] = true, true
+		oi, ni := a.functions[p.i].funcIdx, b.functions[p.j].funcIdx
+		res = append(res, Match{
+			Old:   FuncRef{oi, a.FunctionName(oi)},
+			New:   FuncRef{ni, b.FunctionName(ni)},
+			Score: p.score,
+		})
+	}
+	sort.Slice(res, func(x, y int) bool { return res[x].Old.Index < res[y].Old.Index })
+	return res
+}
+
+func similarSize(a, b int) bool {
+	if a > b {
+		a, b = b, a
+	}
+	return float64(a) >= float64(b)*matchSizeRatio
+}
+
+// stableName returns the name of f if it does not depend on its index
+func (d *Data) stableName(f *hlFunction) (string, bool) {
+	if _, anon := d.lambdaOf(f.funcIdx); f.obj == nil && !anon {
+		return "", false
+	}
+	return d.FunctionName(f.funcIdx), true
+}
@@ -0,0 +1,70 @@
+package hashlink
+
+import "testing"
+
+// opsModule encodes a module of a single function of type () -> void
+// running code on an i32 register r0, r1 being void
+func opsModule(code [][]int) []byte {
+	var w hlbWriter
+	w.WriteString(Magic)
+	w.WriteByte(4)
+	w.index(0) // flags
+	w.index(1) // ints
+	w.index(0) // floats
+	w.index(0) // strings
+	w.index(3) // types
+	w.index(0) // globals
+	w.index(0) // natives
+	w.index(1) // functions
+	w.index(0) // constants
+	w.index(0) // entry point
+
+	w.int32(1)
+	w.stringBlock(nil)
+
+	w.WriteByte(byte(VoidT))
+	w.WriteByte(byte(I32T))
+	w.WriteByte(byte(FunT))
+	w.WriteByte(0)
+	w.index(0)
+
+	w.index(2)
+	w.index(0)
+	w.index(2)
+	w.index(len(code))
+	w.index(1)
+	w.index(0)
+	for _, op := range code {
+		w.WriteByte(byte(op[0]))
+		for _, v := range op[1:] {
+			w.index(v)
+		}
+	}
+	return w.Bytes()
+}
+
+func TestMatchUnrelated(t *testing.T) {
+	a, err := NewData(opsModule([][]int{
+		{int(OpInt), 0, 0},
+		{int(OpIncr), 0},
+		{int(OpIncr), 0},
+		{int(OpRet), 1},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewData(opsModule([][]int{
+		{int(OpInt), 0, 0},
+		{int(OpNeg), 0, 0},
+		{int(OpNeg), 0, 0},
+		{int(OpRet), 1},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Resolve()
+	b.Resolve()
+	if m := MatchFunctions(a, b); len(m) != 0 {
+		t.Errorf("functions of different code matched: %+v", m)
+	}
+}
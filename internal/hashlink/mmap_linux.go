@@ -0,0 +1,31 @@
+//go:build linux
+
+package hashlink
+
+import (
+	"os"
+	"syscall"
+)
+
+// mapFile maps a private read only copy of file name into memory
+func mapFile(name string) ([]byte, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fs, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if fs.Size() == 0 {
+		return nil, ErrNotValidHLB
+	}
+
+	return syscall.Mmap(int(f.Fd()), 0, int(fs.Size()), syscall.PROT_READ, syscall.MAP_PRIVATE)
+}
+
+func unmapFile(b []byte) error {
+	return syscall.Munmap(b)
+}
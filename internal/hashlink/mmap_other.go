@@ -0,0 +1,16 @@
+//go:build !linux
+
+package hashlink
+
+import (
+	"os"
+)
+
+// mapFile reads file name into memory on systems without mmap support
+func mapFile(name string) ([]byte, error) {
+	return os.ReadFile(name)
+}
+
+func unmapFile(b []byte) error {
+	return nil
+}
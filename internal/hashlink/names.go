@@ -0,0 +1,157 @@
+package hashlink
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TypeName returns a readable name for type t
+func (d *Data) TypeName(t hlType) string {
+	return d.typeName(t, 0)
+}
+
+// Structural types may be recursive so nesting is capped
+const maxTypeDepth = 8
+
+func (d *Data) typeName(t hlType, depth int) string {
+	if depth > maxTypeDepth {
+		return "..."
+	}
+	if s := d.typeSymbols[t]; s != nil && s.Name != "" {
+		return s.Name
+	}
+	depth++
+	switch t := t.(type) {
+	case nil:
+		return "?"
+	case *VoidType:
+		return "void"
+	case *UI8Type:
+		return "ui8"
+	case *UI16Type:
+		return "ui16"
+	case *I32Type:
+		return "i32"
+	case *I64Type:
+		return "i64"
+	case *F32Type:
+		return "f32"
+	case *F64Type:
+		return "f64"
+	case *BoolType:
+		return "bool"
+	case *BytesType:
+		return "bytes"
+	case *DynType:
+		return "dynamic"
+	case *FunType:
+		args := make([]string, len(t.argIdx))
+		for i := range t.argIdx {
+			args[i] = d.typeName(d.LookupType(t.argIdx[i]), depth)
+		}
+		return fmt.Sprintf("(%s) -> %s", strings.Join(args, ", "), d.typeName(d.LookupType(t.retIdx), depth))
+	case *ObjType:
+		return d.strings.String(t.nameIdx)
+	case *ArrayType:
+		return "array"
+	case *TypeType:
+		return "type"
+	case *RefType:
+		if t.packed {
+			return "packed<" + d.typeName(d.LookupType(t.paramIdx), depth) + ">"
+		}
+		return "ref<" + d.typeName(d.LookupType(t.paramIdx), depth) + ">"
+	case *VirtualType:
+		fields := make([]string, len(t.field))
+		for i := range t.field {
+			fields[i] = d.strings.String(t.field[i].nameIdx) + ":" + d.typeName(d.LookupType(t.field[i].typeIdx), depth)
+		}
+		return "virtual<" + strings.Join(fields, ", ") + ">"
+	case *DynObjType:
+		return "dynobj"
+	case *AbstractType:
+		return "abstract<" + d.strings.String(t.nameIdx) + ">"
+	case *EnumType:
+		if d.strings.String(t.nameIdx) == "" && len(t.lConstruct) == 1 {
+			// Anonymous enums hold the variables captured by closures
+			c := t.lConstruct[0]
+			args := make([]string, len(c.argIdx))
+			for i := range c.argIdx {
+				args[i] = d.typeName(d.LookupType(c.argIdx[i]), depth)
+			}
+			return "env<" + strings.Join(args, ", ") + ">"
+		}
+		return d.strings.String(t.nameIdx)
+	case *NullType:
+		return "null<" + d.typeName(d.LookupType(t.paramIdx), depth) + ">"
+	}
+	return fmt.Sprintf("%T", t)
+}
+
+// FunctionName returns the qualified name of function index i. Natives
+// are named lib.name, methods Class.field, anonymous functions after
+// their creator as Class.field$lambdaN and anything else fun@i, unless
+// the attached symbol map names the function.
+func (d *Data) FunctionName(i int) string {
+	if s := d.symbols.function(i); s != nil && s.Name != "" {
+		return s.Name
+	}
+	switch f := d.LookupFunction(i).(type) {
+	case *hlNative:
+		return d.strings.String(f.libIdx) + "." + d.strings.String(f.nameIdx)
+	case *hlFunction:
+		if t, ok := f.obj.(*ObjType); ok {
+			return d.strings.String(t.nameIdx) + "." + string(f.field)
+		}
+		if l, ok := d.lambdaOf(i); ok {
+			return d.lambdaName(l)
+		}
+	}
+	return fmt.Sprintf("fun@%d", i)
+}
+
+// FunctionType returns the type index of function i, or -1 if there
+// is no such function
+func (d *Data) FunctionType(i int) int {
+	switch f := d.LookupFunction(i).(type) {
+	case *hlNative:
+		return f.typeIdx
+	case *hlFunction:
+		return f.typeIdx
+	}
+	return -1
+}
+
+// FunctionArgs returns the argument and return type indexes of
+// function i, or false if there is no such function
+func (d *Data) FunctionArgs(i int) ([]int, int, bool) {
+	t := d.FunctionType(i)
+	if t < 0 || t >= len(d.types) {
+		return nil, 0, false
+	}
+	ft, ok := d.types[t].(*FunType)
+	if !ok {
+		return nil, 0, false
+	}
+	return ft.argIdx, ft.retIdx, true
+}
+
+// FindFunction returns the index of the function named name as given
+// by FunctionName. Static methods may be given without the leading $
+// of their class name.
+func (d *Data) FindFunction(name string) (int, bool) {
+	if d.funcNames == nil {
+		d.funcNames = make(map[string]int)
+		for _, n := range d.natives {
+			d.funcNames[d.FunctionName(n.funcIdx)] = n.funcIdx
+		}
+		for _, f := range d.functions {
+			d.funcNames[d.FunctionName(f.funcIdx)] = f.funcIdx
+		}
+	}
+	if i, ok := d.funcNames[name]; ok {
+		return i, true
+	}
+	i, ok := d.funcNames["$"+name]
+	return i, ok
+}
@@ -0,0 +1,60 @@
+package hashlink
+
+import (
+	"sort"
+)
+
+// NativeInfo describes a single native function import
+type NativeInfo struct {
+	Index     int       `json:"index"`
+	Name      string    `json:"name"`
+	Args      []string  `json:"args"`
+	Ret       string    `json:"ret"`
+	Signature string    `json:"signature"`
+	CalledBy  []FuncRef `json:"calledBy,omitempty"`
+}
+
+// NativeLib groups the natives imported from one library
+type NativeLib struct {
+	Name    string       `json:"name"`
+	Natives []NativeInfo `json:"natives"`
+}
+
+// Natives returns the native imports grouped by library. Libraries
+// and natives are sorted by name. Resolve must have been called
+// beforehand.
+func (d *Data) Natives() []NativeLib {
+	callers := d.Callers()
+	libs := make(map[string]*NativeLib)
+	for _, n := range d.natives {
+		lib, ok := libs[n.libPtr]
+		if !ok {
+			lib = &NativeLib{Name: n.libPtr}
+			libs[n.libPtr] = lib
+		}
+
+		info := NativeInfo{Index: n.funcIdx, Name: n.namePtr}
+		if ft, ok := d.LookupType(n.typeIdx).(*FunType); ok {
+			info.Args = make([]string, len(ft.argIdx))
+			for i := range ft.argIdx {
+				info.Args[i] = d.TypeName(d.LookupType(ft.argIdx[i]))
+			}
+			info.Ret = d.TypeName(d.LookupType(ft.retIdx))
+			info.Signature = d.TypeName(ft)
+		}
+		for _, c := range callers[n.funcIdx] {
+			info.CalledBy = append(info.CalledBy, FuncRef{c, d.FunctionName(c)})
+		}
+		lib.Natives = append(lib.Natives, info)
+	}
+
+	res := make([]NativeLib, 0, len(libs))
+	for _, lib := range libs {
+		sort.Slice(lib.Natives, func(i, j int) bool {
+			return lib.Natives[i].Name < lib.Natives[j].Name
+		})
+		res = append(res, *lib)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res
+}
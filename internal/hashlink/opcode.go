@@ -2,6 +2,7 @@ package hashlink
 
 import (
 	"fmt"
+	"strconv"
 )
 
 // HAXE Intermediate Language Operation Code
@@ -120,6 +121,8 @@ const (
 	OpRefData
 	OpRefOpffset
 	OpNop
+	OpPrefetch
+	OpAsm
 )
 
 type OpData struct {
@@ -241,33 +244,70 @@ var (
 		OpRefData:    {"refdata", 2},
 		OpRefOpffset: {"refoffset", 3},
 		OpNop:        {"nop", 0},
+		OpPrefetch:   {"prefetch", 3},
+		OpAsm:        {"asm", 3},
 	}
 )
 
-// Haxe Intermediate Language Instruction
+// String returns a unique mnemonic for op. Unlike the disassembly
+// names the call variants are told apart by their argument count.
+func (op HilOp) String() string {
+	switch {
+	case op >= OpCall0 && op <= OpCall4:
+		return "call" + strconv.Itoa(int(op-OpCall0))
+	case op == OpCallN:
+		return "calln"
+	case op >= 0 && int(op) < len(OpCodes):
+		return OpCodes[op].name
+	}
+	return "op" + strconv.Itoa(int(op))
+}
+
+// Haxe Intermediate Language Instruction. The operands of all
+// instructions of a function are kept in one shared arena, each
+// instruction refers to its fixed operands followed by any variable
+// length operands (call arguments or switch targets) by offset.
 type HilInst struct {
-	op    HilOp
-	arg   []int
-	extra []int
+	op     HilOp
+	arena  *[]int
+	off    int32
+	nExtra uint32
+	nArg   uint8
+}
+
+// Expected number of operands per instruction, used to size arenas
+const arenaHint = 3
+
+// args returns the fixed operands of o
+func (o *HilInst) args() []int {
+	end := int(o.off) + int(o.nArg)
+	return (*o.arena)[o.off:end:end]
+}
+
+// extra returns the variable length operands of o
+func (o *HilInst) extra() []int {
+	start := int(o.off) + int(o.nArg)
+	end := start + int(o.nExtra)
+	return (*o.arena)[start:end:end]
 }
 
 func (o *HilInst) Print(ctx *Data) {
 	switch o.op {
 	case OpInt:
-		fmt.Printf("%s %d, %d ; ", OpCodes[o.op].name, o.arg[0], o.arg[1])
-		fmt.Printf("%d, %d\n", ctx.ints[o.arg[0]], ctx.ints[o.arg[1]])
+		fmt.Printf("%s %d, %d ; ", OpCodes[o.op].name, o.args()[0], o.args()[1])
+		fmt.Printf("%d, %d\n", ctx.ints[o.args()[0]], ctx.ints[o.args()[1]])
 	case OpField:
-		fmt.Printf("%s %d, %d[%d] ; \n", OpCodes[o.op].name, o.arg[0], o.arg[1], o.arg[2])
+		fmt.Printf("%s %d, %d[%d] ; \n", OpCodes[o.op].name, o.args()[0], o.args()[1], o.args()[2])
 	case OpJTrue, OpJFalse, OpJNull, OpJNotNull:
-		fmt.Printf("%s %d, %d\n", OpCodes[o.op].name, o.arg[0], o.arg[1])
+		fmt.Printf("%s %d, %d\n", OpCodes[o.op].name, o.args()[0], o.args()[1])
 	case OpJEq, OpJNotEq, OpSwitch:
-		fmt.Printf("%s %d, %d, %d\n", OpCodes[o.op].name, o.arg[0], o.arg[1], o.arg[2])
+		fmt.Printf("%s %d, %d, %d\n", OpCodes[o.op].name, o.args()[0], o.args()[1], o.args()[2])
 	case OpJAlways:
-		fmt.Printf("%s %d\n", OpCodes[o.op].name, o.arg[0])
+		fmt.Printf("%s %d\n", OpCodes[o.op].name, o.args()[0])
 	case OpCall0:
-		tgt := ctx.LookupFunction(o.arg[1])
+		tgt := ctx.LookupFunction(o.args()[1])
 		fmt.Printf("%s ", OpCodes[o.op].name)
-		fmt.Printf("%d,f@%d ; ", o.arg[0], o.arg[1])
+		fmt.Printf("%d,f@%d ; ", o.args()[0], o.args()[1])
 		switch tgt := tgt.(type) {
 		case *hlNative:
 			fmt.Printf(".%s.%s", tgt.libPtr, tgt.namePtr)
@@ -276,9 +316,9 @@ func (o *HilInst) Print(ctx *Data) {
 		}
 		fmt.Println()
 	case OpCall1:
-		tgt := ctx.LookupFunction(o.arg[1])
+		tgt := ctx.LookupFunction(o.args()[1])
 		fmt.Printf("%s ", OpCodes[o.op].name)
-		fmt.Printf("%d,f@%d(%d) ; ", o.arg[0], o.arg[1], o.arg[2])
+		fmt.Printf("%d,f@%d(%d) ; ", o.args()[0], o.args()[1], o.args()[2])
 		switch tgt := tgt.(type) {
 		case *hlNative:
 			fmt.Printf(".%s.%s", tgt.libPtr, tgt.namePtr)
@@ -287,9 +327,9 @@ func (o *HilInst) Print(ctx *Data) {
 		}
 		fmt.Println()
 	case OpCall2:
-		tgt := ctx.LookupFunction(o.arg[1])
+		tgt := ctx.LookupFunction(o.args()[1])
 		fmt.Printf("%s ", OpCodes[o.op].name)
-		fmt.Printf("%d,f@%d(%d, %d) ; ", o.arg[0], o.arg[1], o.arg[2], o.arg[3])
+		fmt.Printf("%d,f@%d(%d, %d) ; ", o.args()[0], o.args()[1], o.args()[2], o.args()[3])
 		switch tgt := tgt.(type) {
 		case *hlNative:
 			fmt.Printf(".%s.%s", tgt.libPtr, tgt.namePtr)
@@ -298,9 +338,9 @@ func (o *HilInst) Print(ctx *Data) {
 		}
 		fmt.Println()
 	case OpCall3:
-		tgt := ctx.LookupFunction(o.arg[1])
+		tgt := ctx.LookupFunction(o.args()[1])
 		fmt.Printf("%s ", OpCodes[o.op].name)
-		fmt.Printf("%d,f@%d(%d, %d, %d) ; ", o.arg[0], o.arg[1], o.arg[2], o.arg[3], o.arg[4])
+		fmt.Printf("%d,f@%d(%d, %d, %d) ; ", o.args()[0], o.args()[1], o.args()[2], o.args()[3], o.args()[4])
 		switch tgt := tgt.(type) {
 		case *hlNative:
 			fmt.Printf(".%s.%s", tgt.libPtr, tgt.namePtr)
@@ -313,15 +353,15 @@ func (o *HilInst) Print(ctx *Data) {
 		fmt.Println()
 	case OpString:
 		fmt.Printf("%s ", OpCodes[o.op].name)
-		fmt.Printf("%d,@%d ; \"%.40s\"", o.arg[0], o.arg[1], ctx.strings.String(o.arg[1]))
+		fmt.Printf("%d,@%d ; \"%.40s\"", o.args()[0], o.args()[1], ctx.strings.String(o.args()[1]))
 		fmt.Println()
 		/*
 			case OpSetField:
 				fmt.Printf("%s ", OpCodes[o.op].name)
-				tgt := ctx.getType(o.arg[0])
+				tgt := ctx.getType(o.args()[0])
 				switch tgt := tgt.(type) {
 				case *hxtObj:
-					fmt.Printf("%s.%d, %d ; (%d)", tgt.name, o.arg[1], o.arg[2], len(tgt.lField))
+					fmt.Printf("%s.%d, %d ; (%d)", tgt.name, o.args()[1], o.args()[2], len(tgt.lField))
 		*/
 	default:
 		fmt.Printf("%s", OpCodes[o.op].name)
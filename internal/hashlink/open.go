@@ -0,0 +1,50 @@
+package hashlink
+
+import (
+	"bytes"
+)
+
+// NewDataOptions decodes a module held in memory as directed by opt.
+// With Options.LazyCode each function keeps a slice of b covering its
+// encoded instructions, so b must stay untouched while in use.
+func NewDataOptions(b hlbStream, opt *Options) (*Data, error) {
+	return decode(newSliceStream(b), opt)
+}
+
+// Open decodes the module found in file name, which may be a bare
+// HLB file or a file embedding one such as an executable. Where
+// supported the file is memory mapped rather than read so that with
+// Options.LazyCode function bodies are only paged in when decoded.
+// Close releases the mapping.
+func Open(name string, opt *Options) (*Data, error) {
+	buf, err := mapFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	i := bytes.Index(buf, []byte(Magic))
+	if i < 0 {
+		unmapFile(buf)
+		return nil, ErrNotValidHLB
+	}
+
+	d, err := NewDataOptions(buf[i:], opt)
+	if err != nil {
+		unmapFile(buf)
+		return nil, err
+	}
+	d.mapped = buf
+	return d, nil
+}
+
+// Close releases the file backing a module returned by Open. Tables
+// such as the strings and bytes pools are copied while decoding, but
+// lazily decoded functions must not be used after closing.
+func (d *Data) Close() error {
+	if d.mapped == nil {
+		return nil
+	}
+	err := unmapFile(d.mapped)
+	d.mapped = nil
+	return err
+}
@@ -0,0 +1,142 @@
+package hashlink
+
+import (
+	"io"
+)
+
+// DeadBlock is a basic block that control can never reach
+type DeadBlock struct {
+	FuncRef
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// Reachability lists the code that can never run
+type Reachability struct {
+	Functions []FuncRef   `json:"functions"`
+	Blocks    []DeadBlock `json:"blocks"`
+
+	live []bool
+}
+
+// Reachable reports whether function fn may be called
+func (r *Reachability) Reachable(fn int) bool {
+	return fn >= 0 && fn < len(r.live) && r.live[fn]
+}
+
+// Reachability computes the functions reachable from the entry point.
+// A function is reached when called directly or turned into a closure
+// by reachable code. Instantiating a class, or taking its type, reaches
+// the methods and bound fields of the class and its super classes.
+// Loading the global
+// of a class reaches its bindings, as the class may be inspected by
+// reflection. Resolve must have been called beforehand.
+func (d *Data) Reachability() *Reachability {
+	r := &Reachability{live: d.reachable([]int{d.entryPoint})}
+
+	for _, f := range d.functions {
+		ref := FuncRef{f.funcIdx, d.FunctionName(f.funcIdx)}
+		if !r.live[f.funcIdx] {
+			r.Functions = append(r.Functions, ref)
+			continue
+		}
+		g := flowGraph(f)
+		if len(g.Blocks) == 0 {
+			continue
+		}
+		seen := make([]bool, len(g.Blocks))
+		for _, b := range reversePostorder(g) {
+			seen[b] = true
+		}
+		for i, b := range g.Blocks {
+			if !seen[i] {
+				r.Blocks = append(r.Blocks, DeadBlock{ref, b.Start, b.End - 1})
+			}
+		}
+	}
+	return r
+}
+
+// reachable marks the functions reachable from roots
+func (d *Data) reachable(roots []int) []bool {
+	live := make([]bool, len(d.funcLookup))
+	var work []int
+	reach := func(fn int) {
+		if fn >= 0 && fn < len(live) && !live[fn] {
+			live[fn] = true
+			work = append(work, fn)
+		}
+	}
+	classes := make(map[*ObjType]bool)
+	instantiate := func(t hlType) {
+		for o, _ := t.(*ObjType); o != nil && !classes[o]; o = o.superPtr {
+			classes[o] = true
+			for _, p := range o.lProto {
+				reach(p.funcIdx)
+			}
+			for _, b := range o.lBinding {
+				reach(b.funcIdx)
+			}
+		}
+	}
+	statics := make(map[int]bool)
+
+	for _, fn := range roots {
+		reach(fn)
+	}
+	for len(work) > 0 {
+		fn := work[len(work)-1]
+		work = work[:len(work)-1]
+		f, ok := d.LookupFunction(fn).(*hlFunction)
+		if !ok {
+			continue
+		}
+		code := f.code()
+		for i := range code {
+			o := &code[i]
+			a := o.args()
+			switch o.op {
+			case OpCall0, OpCall1, OpCall2, OpCall3, OpCall4, OpCallN,
+				OpStaticClosure, OpInstanceClosure:
+				reach(a[1])
+			case OpNew:
+				instantiate(d.regType(f, a[0]))
+			case OpType:
+				if a[1] >= 0 && a[1] < len(d.types) {
+					instantiate(d.types[a[1]])
+				}
+			case OpGetGlobal:
+				g := a[1]
+				if g < 0 || g >= len(d.globals) || statics[g] {
+					continue
+				}
+				statics[g] = true
+				if t, ok := d.globals[g].(*ObjType); ok {
+					for _, b := range t.lBinding {
+						reach(b.funcIdx)
+					}
+				}
+			}
+		}
+	}
+	return live
+}
+
+// Strip writes d without its unreachable functions. Methods and bound
+// fields are kept along with the code they use even when unreachable,
+// as removing them would change the layout of their class.
+func (d *Data) Strip(w io.Writer) error {
+	roots := []int{d.entryPoint}
+	for _, t := range d.types {
+		if o, ok := t.(*ObjType); ok {
+			for _, p := range o.lProto {
+				roots = append(roots, p.funcIdx)
+			}
+			for _, b := range o.lBinding {
+				roots = append(roots, b.funcIdx)
+			}
+		}
+	}
+	live := d.reachable(roots)
+	return d.Encode(w, func(fn int) bool { return live[fn] })
+}
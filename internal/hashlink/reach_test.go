@@ -0,0 +1,119 @@
+package hashlink
+
+import (
+	"bytes"
+	"testing"
+)
+
+// bindModule encodes a module whose entry point instantiates class A.
+// Function 1 is never used, functions 2 and 3 are bound to a field of
+// class A and of class B, which is never instantiated.
+func bindModule() []byte {
+	var w hlbWriter
+	w.WriteString(Magic)
+	w.WriteByte(4)
+	w.index(0) // flags
+	w.index(0) // ints
+	w.index(0) // floats
+	w.index(4) // strings
+	w.index(4) // types
+	w.index(0) // globals
+	w.index(0) // natives
+	w.index(4) // functions
+	w.index(0) // constants
+	w.index(0) // entry point
+
+	w.stringBlock([][]byte{[]byte("A"), []byte("f"), []byte("B"), []byte("g")})
+
+	w.WriteByte(byte(VoidT))
+	w.WriteByte(byte(FunT))
+	w.WriteByte(0)
+	w.index(0)
+	for i, c := range [][2]int{{0, 1}, {2, 3}} {
+		w.WriteByte(byte(ObjT))
+		w.index(c[0])
+		w.index(-1)
+		w.index(0)
+		w.index(1) // fields
+		w.index(0) // protos
+		w.index(1) // bindings
+		w.index(c[1])
+		w.index(1)
+		w.index(0)
+		w.index(2 + i)
+	}
+
+	w.index(1)
+	w.index(0)
+	w.index(2)
+	w.index(2)
+	w.index(0)
+	w.index(2)
+	w.WriteByte(byte(OpNew))
+	w.index(1)
+	w.WriteByte(byte(OpRet))
+	w.index(0)
+	for fn := 1; fn < 4; fn++ {
+		w.index(1)
+		w.index(fn)
+		w.index(1)
+		w.index(1)
+		w.index(0)
+		w.WriteByte(byte(OpRet))
+		w.index(0)
+	}
+	return w.Bytes()
+}
+
+func TestEncode(t *testing.T) {
+	for name, buf := range map[string][]byte{
+		"synthetic": syntheticModule(10, 30),
+		"v5":        v5Module(),
+		"bind":      bindModule(),
+	} {
+		d, err := NewData(buf)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		var out bytes.Buffer
+		if err := d.Encode(&out, nil); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !bytes.Equal(out.Bytes(), buf) {
+			t.Errorf("%s: encoding differs from the decoded module", name)
+		}
+	}
+}
+
+func TestStrip(t *testing.T) {
+	d, err := NewData(bindModule())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Resolve()
+	r := d.Reachability()
+	for fn, want := range []bool{true, false, true, false} {
+		if r.Reachable(fn) != want {
+			t.Errorf("function %d reachable: %v, want %v", fn, !want, want)
+		}
+	}
+
+	var out bytes.Buffer
+	if err := d.Strip(&out); err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewData(out.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Resolve()
+	if len(s.functions) != 3 {
+		t.Errorf("stripped module has %d functions, want 3", len(s.functions))
+	}
+	for _, i := range []int{2, 3} {
+		o := s.LookupType(i).(*ObjType)
+		if len(o.lBinding) != 1 {
+			t.Errorf("class %s lost its binding", o.namePtr)
+		}
+	}
+}
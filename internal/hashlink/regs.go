@@ -0,0 +1,383 @@
+package hashlink
+
+import (
+	"math/bits"
+)
+
+// RegInfo describes a register of a function
+type RegInfo struct {
+	Index int    `json:"index"`
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+}
+
+// Registers returns the registers of function fn with their declared
+// types, or nil if fn is not a bytecode function.
+func (d *Data) Registers(fn int) []RegInfo {
+	f, ok := d.LookupFunction(fn).(*hlFunction)
+	if !ok {
+		return nil
+	}
+	res := make([]RegInfo, len(f.regIdx))
+	for r := range res {
+		res[r] = RegInfo{r, d.regName(f, r), d.TypeName(d.regType(f, r))}
+	}
+	return res
+}
+
+// defUse returns the register written by o, or -1 if none, and appends
+// the registers read by o to uses. The exception register of OpTrap
+// is treated as written by the trap.
+func (o *HilInst) defUse(uses []int) (int, []int) {
+	a, x := o.args(), o.extra()
+	switch o.op {
+	case OpInt, OpFloat, OpBool, OpBytes, OpString, OpNull,
+		OpStaticClosure, OpGetGlobal, OpNew, OpType, OpEnumAlloc, OpTrap:
+		return a[0], uses
+	case OpMov, OpNeg, OpNot, OpVirtualClosure, OpField, OpDynGet,
+		OpToDyn, OpToSFloat, OpToUFloat, OpToInt, OpSafeCast, OpUnsafeCast, OpToVirtual,
+		OpArraySize, OpGetType, OpGetTID, OpRef, OpUnref, OpEnumIndex, OpEnumField, OpRefData:
+		return a[0], append(uses, a[1])
+	case OpAdd, OpSub, OpMul, OpSDiv, OpUDiv, OpSMod, OpUMod,
+		OpShl, OpSShr, OpUShr, OpAnd, Opr, OpXor,
+		OpGetI8, OpGetI16, OpGetMem, OpGetArray, OpRefOpffset:
+		return a[0], append(uses, a[1], a[2])
+	case OpIncr, OpDecr:
+		return a[0], append(uses, a[0])
+	case OpCall0, OpCall1, OpCall2, OpCall3, OpCall4:
+		return a[0], append(uses, a[2:]...)
+	case OpCallN, OpCallMethod, OpMakeEnum:
+		return a[0], append(uses, x...)
+	case OpCallThis:
+		return a[0], append(append(uses, 0), x...)
+	case OpCallClosure:
+		return a[0], append(append(uses, a[1]), x...)
+	case OpInstanceClosure:
+		return a[0], append(uses, a[2])
+	case OpGetThis:
+		return a[0], append(uses, 0)
+	case OpSetThis:
+		return -1, append(uses, 0, a[1])
+	case OpSetGlobal:
+		return -1, append(uses, a[1])
+	case OpSetField, OpDynSet, OpSetEnumField:
+		return -1, append(uses, a[0], a[2])
+	case OpSetI8, OpSetI16, OpSetMem, OpSetArray:
+		return -1, append(uses, a[0], a[1], a[2])
+	case OpSetref:
+		return -1, append(uses, a[0], a[1])
+	case OpJTrue, OpJFalse, OpJNull, OpJNotNull,
+		OpRet, OpThrow, OpRethrow, OpSwitch, OpNullCheck, OpPrefetch:
+		return -1, append(uses, a[0])
+	case OpJSLt, OpJSGte, OpJSGt, OpJSLte, OpJULt, OpJUGte,
+		OpJNotLt, OpJNotGte, OpJEq, OpJNotEq:
+		return -1, append(uses, a[0], a[1])
+	}
+	return -1, uses
+}
+
+// hasEffect reports whether o does more than write its register, in
+// which case an unused result does not make it a dead store.
+func (o *HilInst) hasEffect() bool {
+	switch o.op {
+	case OpCall0, OpCall1, OpCall2, OpCall3, OpCall4, OpCallN,
+		OpCallMethod, OpCallThis, OpCallClosure, OpDynGet, OpTrap, OpIncr, OpDecr, OpAsm:
+		return true
+	}
+	return false
+}
+
+// regSet is a set of register or definition indexes
+type regSet []uint64
+
+func newRegSet(n int) regSet { return make(regSet, (n+63)/64) }
+
+func (s regSet) add(i int)         { s[i/64] |= 1 << uint(i%64) }
+func (s regSet) remove(i int)      { s[i/64] &^= 1 << uint(i%64) }
+func (s regSet) has(i int) bool    { return s[i/64]&(1<<uint(i%64)) != 0 }
+func (s regSet) copyFrom(o regSet) { copy(s, o) }
+func (s regSet) clone() regSet     { return append(regSet(nil), s...) }
+
+// union adds o to s and reports whether s changed
+func (s regSet) union(o regSet) bool {
+	changed := false
+	for i := range s {
+		if v := s[i] | o[i]; v != s[i] {
+			s[i] = v
+			changed = true
+		}
+	}
+	return changed
+}
+
+func (s regSet) list() []int {
+	var res []int
+	for i, w := range s {
+		for w != 0 {
+			b := bits.TrailingZeros64(w)
+			res = append(res, i*64+b)
+			w &^= 1 << uint(b)
+		}
+	}
+	return res
+}
+
+// DefUse links a definition of a register to the instructions reading
+// it. Def is the defining instruction, or -1 for a function argument.
+type DefUse struct {
+	Reg  int   `json:"reg"`
+	Def  int   `json:"def"`
+	Uses []int `json:"uses,omitempty"`
+}
+
+// Analysis holds the register dataflow of a function
+type Analysis struct {
+	Graph  *CFG     `json:"graph"`
+	Chains []DefUse `json:"chains"`
+
+	code    []HilInst
+	nReg    int
+	liveOut []regSet // per instruction
+	reach   [][]int  // per instruction, chains reaching each use
+	dead    []bool
+}
+
+// Analyze computes def-use chains and register liveness of function
+// fn, or returns nil if fn is not a bytecode function.
+func (d *Data) Analyze(fn int) *Analysis {
+	f, ok := d.LookupFunction(fn).(*hlFunction)
+	if !ok {
+		return nil
+	}
+	return d.analyze(f)
+}
+
+func (d *Data) analyze(f *hlFunction) *Analysis {
+	code := f.code()
+	a := &Analysis{Graph: flowGraph(f), code: code, nReg: len(f.regIdx)}
+	a.chains(d, f)
+	a.liveness()
+
+	a.dead = make([]bool, len(code))
+	for pc := range code {
+		o := &code[pc]
+		def, _ := o.defUse(nil)
+		if def < 0 || def >= a.nReg || o.hasEffect() || a.liveOut[pc].has(def) {
+			continue
+		}
+		if _, void := d.regType(f, def).(*VoidType); !void {
+			a.dead[pc] = true
+		}
+	}
+	return a
+}
+
+// validReg drops register indexes out of range
+func (a *Analysis) validReg(r int) bool { return r >= 0 && r < a.nReg }
+
+// chains computes the reaching definitions of every use. Arguments
+// are defined on entry. Definitions made inside a try region reach
+// its handler from any point of the region.
+func (a *Analysis) chains(d *Data, f *hlFunction) {
+	nArg := 0
+	if ft, ok := d.LookupType(f.typeIdx).(*FunType); ok {
+		nArg = len(ft.argIdx)
+	}
+	byReg := make([][]int, a.nReg)
+	for r := 0; r < nArg && r < a.nReg; r++ {
+		byReg[r] = append(byReg[r], len(a.Chains))
+		a.Chains = append(a.Chains, DefUse{Reg: r, Def: -1})
+	}
+	defOf := make([]int, len(a.code))
+	for pc := range a.code {
+		defOf[pc] = -1
+		if r, _ := a.code[pc].defUse(nil); a.validReg(r) {
+			defOf[pc] = len(a.Chains)
+			byReg[r] = append(byReg[r], len(a.Chains))
+			a.Chains = append(a.Chains, DefUse{Reg: r, Def: pc})
+		}
+	}
+
+	n := len(a.Chains)
+	blocks := a.Graph.Blocks
+	gen := make([]regSet, len(blocks))
+	all := make([]regSet, len(blocks))
+	kill := make([]regSet, len(blocks))
+	in := make([]regSet, len(blocks))
+	out := make([]regSet, len(blocks))
+	for i, b := range blocks {
+		gen[i], all[i], kill[i] = newRegSet(n), newRegSet(n), newRegSet(n)
+		in[i], out[i] = newRegSet(n), newRegSet(n)
+		for pc := b.Start; pc < b.End; pc++ {
+			c := defOf[pc]
+			if c < 0 {
+				continue
+			}
+			for _, o := range byReg[a.Chains[c].Reg] {
+				gen[i].remove(o)
+				kill[i].add(o)
+			}
+			gen[i].add(c)
+			all[i].add(c)
+		}
+	}
+	if len(blocks) > 0 {
+		for c := 0; c < nArg && c < a.nReg; c++ {
+			in[0].add(c)
+		}
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for i, b := range blocks {
+			for _, e := range b.Pred {
+				p := e.Block
+				if e.Exceptional {
+					changed = in[i].union(in[p]) || changed
+					changed = in[i].union(all[p]) || changed
+				} else {
+					changed = in[i].union(out[p]) || changed
+				}
+			}
+			o := in[i].clone()
+			for j := range o {
+				o[j] = o[j]&^kill[i][j] | gen[i][j]
+			}
+			if !equalSets(o, out[i]) {
+				out[i].copyFrom(o)
+				changed = true
+			}
+		}
+	}
+
+	a.reach = make([][]int, len(a.code))
+	var uses []int
+	for i, b := range blocks {
+		cur := in[i].clone()
+		for pc := b.Start; pc < b.End; pc++ {
+			_, uses = a.code[pc].defUse(uses[:0])
+			for _, r := range uses {
+				if !a.validReg(r) {
+					continue
+				}
+				for _, c := range byReg[r] {
+					if cur.has(c) {
+						a.reach[pc] = append(a.reach[pc], c)
+						u := a.Chains[c].Uses
+						if len(u) == 0 || u[len(u)-1] != pc {
+							a.Chains[c].Uses = append(u, pc)
+						}
+					}
+				}
+			}
+			if c := defOf[pc]; c >= 0 {
+				for _, o := range byReg[a.Chains[c].Reg] {
+					cur.remove(o)
+				}
+				cur.add(c)
+			}
+		}
+	}
+}
+
+func equalSets(a, b regSet) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// liveness computes the registers live after each instruction. An
+// exception may be raised anywhere in a try region so registers live
+// at the handler are live throughout the region. Registers whose
+// address is taken by OpRef may be read through the reference at any
+// point and are live everywhere.
+func (a *Analysis) liveness() {
+	blocks := a.Graph.Blocks
+	use := make([]regSet, len(blocks))
+	def := make([]regSet, len(blocks))
+	in := make([]regSet, len(blocks))
+	exc := make([]regSet, len(blocks))
+	addressed := newRegSet(a.nReg)
+	for pc := range a.code {
+		if o := &a.code[pc]; o.op == OpRef && a.validReg(o.args()[1]) {
+			addressed.add(o.args()[1])
+		}
+	}
+	var uses []int
+	for i, b := range blocks {
+		use[i], def[i] = newRegSet(a.nReg), newRegSet(a.nReg)
+		in[i], exc[i] = newRegSet(a.nReg), newRegSet(a.nReg)
+		for pc := b.Start; pc < b.End; pc++ {
+			var r int
+			r, uses = a.code[pc].defUse(uses[:0])
+			for _, u := range uses {
+				if a.validReg(u) && !def[i].has(u) {
+					use[i].add(u)
+				}
+			}
+			if a.validReg(r) {
+				def[i].add(r)
+			}
+		}
+	}
+
+	outOf := func(i int) regSet {
+		o := newRegSet(a.nReg)
+		for _, e := range blocks[i].Succ {
+			o.union(in[e.Block])
+		}
+		return o
+	}
+	for changed := true; changed; {
+		changed = false
+		for i := len(blocks) - 1; i >= 0; i-- {
+			for _, e := range blocks[i].Succ {
+				if e.Exceptional {
+					exc[i].union(in[e.Block])
+				}
+			}
+			n := outOf(i)
+			for j := range n {
+				n[j] = n[j]&^def[i][j] | use[i][j] | exc[i][j]
+			}
+			if !equalSets(n, in[i]) {
+				in[i].copyFrom(n)
+				changed = true
+			}
+		}
+	}
+
+	a.liveOut = make([]regSet, len(a.code))
+	for i, b := range blocks {
+		live := outOf(i)
+		for pc := b.End - 1; pc >= b.Start; pc-- {
+			a.liveOut[pc] = live.clone()
+			a.liveOut[pc].union(exc[i])
+			a.liveOut[pc].union(addressed)
+			var r int
+			r, uses = a.code[pc].defUse(uses[:0])
+			if a.validReg(r) {
+				live.remove(r)
+			}
+			for _, u := range uses {
+				if a.validReg(u) {
+					live.add(u)
+				}
+			}
+		}
+	}
+}
+
+// LiveOut returns the registers live after instruction pc
+func (a *Analysis) LiveOut(pc int) []int { return a.liveOut[pc].list() }
+
+// Reaching returns the definitions reaching the registers read by
+// instruction pc, as indexes into Chains.
+func (a *Analysis) Reaching(pc int) []int { return a.reach[pc] }
+
+// DeadStore reports whether instruction pc only writes a register
+// that is never read afterwards
+func (a *Analysis) DeadStore(pc int) bool { return a.dead[pc] }
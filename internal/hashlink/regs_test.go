@@ -0,0 +1,64 @@
+package hashlink
+
+import "testing"
+
+// refModule encodes a function storing to a register whose address
+// was taken, then reading it back through the reference
+func refModule() []byte {
+	var w hlbWriter
+	w.WriteString(Magic)
+	w.WriteByte(4)
+	w.index(0) // flags
+	w.index(1) // ints
+	w.index(0) // floats
+	w.index(0) // strings
+	w.index(3) // types
+	w.index(0) // globals
+	w.index(0) // natives
+	w.index(1) // functions
+	w.index(0) // constants
+	w.index(0) // entry point
+
+	w.int32(1)
+	w.stringBlock(nil)
+
+	w.WriteByte(byte(I32T))
+	w.WriteByte(byte(RefT))
+	w.index(0)
+	w.WriteByte(byte(FunT))
+	w.WriteByte(0)
+	w.index(0)
+
+	w.index(2)
+	w.index(0)
+	w.index(3)
+	w.index(5)
+	for _, r := range []int{0, 1, 0} {
+		w.index(r)
+	}
+	for _, op := range [][]int{
+		{int(OpInt), 0, 0},
+		{int(OpRef), 1, 0},
+		{int(OpInt), 0, 0},
+		{int(OpUnref), 2, 1},
+		{int(OpRet), 2},
+	} {
+		w.WriteByte(byte(op[0]))
+		for _, v := range op[1:] {
+			w.index(v)
+		}
+	}
+	return w.Bytes()
+}
+
+func TestAddressedRegister(t *testing.T) {
+	d, err := NewData(refModule())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Resolve()
+	a := d.Analyze(0)
+	if a.DeadStore(2) {
+		t.Error("store to a referenced register reported dead")
+	}
+}
@@ -0,0 +1,554 @@
+package hashlink
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ValueKind tells how an SSA value is defined
+type ValueKind int
+
+const (
+	// ValueInst is an instruction, possibly without a result
+	ValueInst ValueKind = iota
+	// ValuePhi merges the values of a register at a join point
+	ValuePhi
+	// ValueParam is a function argument
+	ValueParam
+	// ValueUndef stands for a register read before being written
+	ValueUndef
+)
+
+// Value is a node of the SSA form. Instructions are values even when
+// they do not write a register, in which case Reg is -1. Args are the
+// registers read, in the order of the instruction or, for phis, of the
+// block predecessors. Aux is the main non register operand such as a
+// constant pool, function, global, field or type index, or -1.
+type Value struct {
+	ID    int
+	Kind  ValueKind
+	Op    HilOp
+	PC    int
+	Reg   int
+	Aux   int
+	Args  []*Value
+	Uses  []*Value
+	Block *SSABlock
+
+	typ hlType
+}
+
+func (v *Value) String() string { return "v" + strconv.Itoa(v.ID) }
+
+// HasResult reports whether v writes a register
+func (v *Value) HasResult() bool { return v.Reg >= 0 }
+
+// TypeId returns the kind of the value type
+func (v *Value) TypeId() HdtId {
+	if v.typ == nil {
+		return VoidT
+	}
+	return v.typ.Id()
+}
+
+// TypeName returns a readable name of the value type
+func (v *Value) TypeName() string { return v.Block.Func.d.TypeName(v.typ) }
+
+// SSABlock is a basic block in SSA form. Phis come before Instrs.
+type SSABlock struct {
+	Index  int
+	Phis   []*Value
+	Instrs []*Value
+	Preds  []*SSABlock
+	Succs  []*SSABlock
+	Idom   *SSABlock
+	Func   *SSAFunc
+}
+
+// SSAFunc is a function in SSA form. Blocks unreachable from the
+// entry are left out.
+type SSAFunc struct {
+	Index  int
+	Name   string
+	Blocks []*SSABlock
+	Params []*Value
+	Undef  []*Value
+
+	d      *Data
+	values int
+}
+
+func (fn *SSAFunc) newValue(b *SSABlock, kind ValueKind, reg int, typ hlType) *Value {
+	v := &Value{ID: fn.values, Kind: kind, PC: -1, Reg: reg, Aux: -1, Block: b, typ: typ}
+	fn.values++
+	return v
+}
+
+// NumValues returns an upper bound of the value IDs of fn
+func (fn *SSAFunc) NumValues() int { return fn.values }
+
+// SSA converts function fn to SSA form, or returns nil if fn is not
+// a bytecode function. Phis are only placed where the register is
+// live. Blocks inside try regions are split before each instruction
+// writing a register so that exceptional edges carry every value the
+// handler may observe.
+func (d *Data) SSA(fn int) *SSAFunc {
+	f, ok := d.LookupFunction(fn).(*hlFunction)
+	if !ok {
+		return nil
+	}
+	return d.ssa(f)
+}
+
+func (d *Data) ssa(f *hlFunction) *SSAFunc {
+	return d.buildSSA(f, d.analyze(f))
+}
+
+// buildSSA converts f using its register analysis
+func (d *Data) buildSSA(f *hlFunction, an *Analysis) *SSAFunc {
+	code := an.code
+	g := splitTry(an.Graph, code)
+	fn := &SSAFunc{Index: f.funcIdx, Name: d.FunctionName(f.funcIdx), d: d}
+	if len(g.Blocks) == 0 {
+		return fn
+	}
+
+	// Number reachable blocks in reverse postorder
+	order := reversePostorder(g)
+	rpo := make([]int, len(g.Blocks))
+	for i := range rpo {
+		rpo[i] = -1
+	}
+	for i, b := range order {
+		rpo[b] = i
+	}
+	fn.Blocks = make([]*SSABlock, len(order))
+	for i := range order {
+		fn.Blocks[i] = &SSABlock{Index: i, Func: fn}
+	}
+	for i, b := range order {
+		sb := fn.Blocks[i]
+		for _, e := range g.Blocks[b].Succ {
+			if s := fn.Blocks[rpo[e.Block]]; !containsBlock(sb.Succs, s) {
+				sb.Succs = append(sb.Succs, s)
+				s.Preds = append(s.Preds, sb)
+			}
+		}
+	}
+	dominators(fn.Blocks)
+	df := frontiers(fn.Blocks)
+
+	// Registers written in each block
+	nReg := len(f.regIdx)
+	defs := make([][]int, nReg)
+	for i, b := range order {
+		for pc := g.Blocks[b].Start; pc < g.Blocks[b].End; pc++ {
+			if r, _ := code[pc].defUse(nil); r >= 0 && r < nReg {
+				if l := defs[r]; len(l) == 0 || l[len(l)-1] != i {
+					defs[r] = append(l, i)
+				}
+			}
+		}
+	}
+	nArg := 0
+	if ft, ok := d.LookupType(f.typeIdx).(*FunType); ok {
+		nArg = len(ft.argIdx)
+	}
+	entry := fn.Blocks[0]
+	for r := 0; r < nArg && r < nReg; r++ {
+		v := fn.newValue(entry, ValueParam, r, d.regType(f, r))
+		fn.Params = append(fn.Params, v)
+		if l := defs[r]; len(l) == 0 || l[0] != 0 {
+			defs[r] = append([]int{0}, l...)
+		}
+	}
+
+	// Place phis on the iterated dominance frontier. Registers live
+	// at a handler are live throughout its try region, even where
+	// written, as the write may raise.
+	liveIn := func(b, r int) bool {
+		gb := &g.Blocks[order[b]]
+		def, uses := code[gb.Start].defUse(nil)
+		for _, u := range uses {
+			if u == r {
+				return true
+			}
+		}
+		exc := len(gb.Succ) > 0 && gb.Succ[len(gb.Succ)-1].Exceptional
+		return (def != r || exc) && an.liveOut[gb.Start].has(r)
+	}
+	for r := range defs {
+		has := make([]bool, len(fn.Blocks))
+		work := append([]int(nil), defs[r]...)
+		for len(work) > 0 {
+			b := work[len(work)-1]
+			work = work[:len(work)-1]
+			for _, y := range df[b] {
+				if has[y] || !liveIn(y, r) {
+					continue
+				}
+				has[y] = true
+				sb := fn.Blocks[y]
+				phi := fn.newValue(sb, ValuePhi, r, d.regType(f, r))
+				phi.Args = make([]*Value, len(sb.Preds))
+				sb.Phis = append(sb.Phis, phi)
+				work = append(work, y)
+			}
+		}
+	}
+
+	// Rename along the dominator tree
+	children := make([][]*SSABlock, len(fn.Blocks))
+	for _, b := range fn.Blocks[1:] {
+		children[b.Idom.Index] = append(children[b.Idom.Index], b)
+	}
+	cur := make([]*Value, nReg)
+	for _, p := range fn.Params {
+		cur[p.Reg] = p
+	}
+	read := func(r int) *Value {
+		if r < 0 || r >= nReg {
+			return nil
+		}
+		if cur[r] == nil {
+			u := fn.newValue(entry, ValueUndef, r, d.regType(f, r))
+			fn.Undef = append(fn.Undef, u)
+			cur[r] = u
+		}
+		return cur[r]
+	}
+	var rename func(b *SSABlock)
+	rename = func(b *SSABlock) {
+		saved := append([]*Value(nil), cur...)
+		for _, phi := range b.Phis {
+			cur[phi.Reg] = phi
+		}
+		gb := g.Blocks[order[b.Index]]
+		var uses []int
+		for pc := gb.Start; pc < gb.End; pc++ {
+			o := &code[pc]
+			var r int
+			r, uses = o.defUse(uses[:0])
+			v := fn.newValue(b, ValueInst, -1, nil)
+			v.Op, v.PC, v.Aux = o.op, pc, o.aux()
+			for _, u := range uses {
+				if a := read(u); a != nil {
+					v.Args = append(v.Args, a)
+				}
+			}
+			if r >= 0 && r < nReg {
+				v.Reg, v.typ = r, d.regType(f, r)
+				cur[r] = v
+			}
+			b.Instrs = append(b.Instrs, v)
+		}
+		for _, s := range b.Succs {
+			for i, p := range s.Preds {
+				if p != b {
+					continue
+				}
+				for _, phi := range s.Phis {
+					phi.Args[i] = read(phi.Reg)
+				}
+			}
+		}
+		for _, c := range children[b.Index] {
+			rename(c)
+		}
+		copy(cur, saved)
+	}
+	rename(entry)
+
+	for _, b := range fn.Blocks {
+		for _, v := range b.Phis {
+			addUses(v)
+		}
+		for _, v := range b.Instrs {
+			addUses(v)
+		}
+	}
+	return fn
+}
+
+// splitTry returns g with the blocks of try regions split before each
+// instruction writing a register. Every part keeps the exceptional
+// edges of its block, the last part its other successors. The first
+// part is empty when the block starts with a write.
+func splitTry(g *CFG, code []HilInst) *CFG {
+	res := &CFG{Try: g.Try, block: make([]int, len(code))}
+	first := make([]int, len(g.Blocks))
+	last := make([]int, len(g.Blocks))
+	for i, b := range g.Blocks {
+		first[i] = len(res.Blocks)
+		exc := len(b.Succ) > 0 && b.Succ[len(b.Succ)-1].Exceptional
+		start := b.Start
+		for pc := b.Start; pc < b.End; pc++ {
+			if r, _ := code[pc].defUse(nil); exc && r >= 0 {
+				res.Blocks = append(res.Blocks, Block{Index: len(res.Blocks), Start: start, End: pc})
+				start = pc
+			}
+			res.block[pc] = len(res.Blocks)
+		}
+		res.Blocks = append(res.Blocks, Block{Index: len(res.Blocks), Start: start, End: b.End})
+		last[i] = len(res.Blocks) - 1
+	}
+
+	link := func(from, to int, exc bool) {
+		res.Blocks[from].Succ = append(res.Blocks[from].Succ, Edge{to, exc})
+		res.Blocks[to].Pred = append(res.Blocks[to].Pred, Edge{from, exc})
+	}
+	for i, b := range g.Blocks {
+		for p := first[i]; p <= last[i]; p++ {
+			if p < last[i] {
+				link(p, p+1, false)
+			} else {
+				for _, e := range b.Succ {
+					if !e.Exceptional {
+						link(p, first[e.Block], false)
+					}
+				}
+			}
+			for _, e := range b.Succ {
+				if e.Exceptional {
+					link(p, first[e.Block], true)
+				}
+			}
+		}
+	}
+	return res
+}
+
+func addUses(v *Value) {
+	for _, a := range v.Args {
+		if a != nil {
+			a.Uses = append(a.Uses, v)
+		}
+	}
+}
+
+func containsBlock(l []*SSABlock, b *SSABlock) bool {
+	for _, x := range l {
+		if x == b {
+			return true
+		}
+	}
+	return false
+}
+
+// reversePostorder lists the blocks reachable from the entry
+func reversePostorder(g *CFG) []int {
+	seen := make([]bool, len(g.Blocks))
+	var post []int
+	var visit func(b int)
+	visit = func(b int) {
+		seen[b] = true
+		for _, e := range g.Blocks[b].Succ {
+			if !seen[e.Block] {
+				visit(e.Block)
+			}
+		}
+		post = append(post, b)
+	}
+	visit(0)
+	for i, j := 0, len(post)-1; i < j; i, j = i+1, j-1 {
+		post[i], post[j] = post[j], post[i]
+	}
+	return post
+}
+
+// dominators sets the immediate dominators of blocks given in reverse
+// postorder, see Cooper, Harvey and Kennedy, "A Simple, Fast Dominance
+// Algorithm".
+func dominators(blocks []*SSABlock) {
+	intersect := func(x, y *SSABlock) *SSABlock {
+		for x != y {
+			for x.Index > y.Index {
+				x = x.Idom
+			}
+			for y.Index > x.Index {
+				y = y.Idom
+			}
+		}
+		return x
+	}
+
+	entry := blocks[0]
+	entry.Idom = entry
+	for changed := true; changed; {
+		changed = false
+		for _, b := range blocks[1:] {
+			var idom *SSABlock
+			for _, p := range b.Preds {
+				switch {
+				case p.Idom == nil:
+				case idom == nil:
+					idom = p
+				default:
+					idom = intersect(p, idom)
+				}
+			}
+			if b.Idom != idom {
+				b.Idom = idom
+				changed = true
+			}
+		}
+	}
+	entry.Idom = nil
+}
+
+// frontiers returns the dominance frontier of each block
+func frontiers(blocks []*SSABlock) [][]int {
+	df := make([][]int, len(blocks))
+	for _, b := range blocks {
+		if len(b.Preds) < 2 {
+			continue
+		}
+		for _, p := range b.Preds {
+			for r := p; r != nil && r != b.Idom; r = r.Idom {
+				if l := df[r.Index]; len(l) == 0 || l[len(l)-1] != b.Index {
+					df[r.Index] = append(l, b.Index)
+				}
+			}
+		}
+	}
+	return df
+}
+
+// aux returns the main non register operand of o, or -1
+func (o *HilInst) aux() int {
+	a := o.args()
+	switch o.op {
+	case OpInt, OpFloat, OpBool, OpBytes, OpString, OpType, OpEnumAlloc,
+		OpCall0, OpCall1, OpCall2, OpCall3, OpCall4, OpCallN, OpCallMethod, OpCallThis,
+		OpStaticClosure, OpInstanceClosure, OpGetGlobal, OpGetThis, OpMakeEnum:
+		return a[1]
+	case OpSetGlobal, OpSetThis:
+		return a[0]
+	case OpField, OpDynGet, OpVirtualClosure, OpEnumField:
+		return a[2]
+	case OpSetField, OpDynSet, OpSetEnumField:
+		return a[1]
+	}
+	return -1
+}
+
+// Format returns a readable form of v such as "v3 = add v1, v2"
+func (fn *SSAFunc) Format(v *Value) string {
+	args := make([]string, len(v.Args))
+	for i, a := range v.Args {
+		if a == nil {
+			args[i] = "?"
+		} else {
+			args[i] = a.String()
+		}
+	}
+
+	var s string
+	switch v.Kind {
+	case ValuePhi:
+		for i := range args {
+			args[i] = "b" + strconv.Itoa(v.Block.Preds[i].Index) + ":" + args[i]
+		}
+		s = "phi " + strings.Join(args, ", ")
+	case ValueParam:
+		s = "param"
+	case ValueUndef:
+		s = "undef"
+	default:
+		s = OpCodes[v.Op].name
+		if x := fn.auxString(v); x != "" {
+			args = append([]string{x}, args...)
+		}
+		if len(args) > 0 {
+			s += " " + strings.Join(args, ", ")
+		}
+	}
+	if v.HasResult() {
+		s = fmt.Sprintf("%s:%s = %s ; r%d", v, v.TypeName(), s, v.Reg)
+	}
+	return s
+}
+
+func (fn *SSAFunc) auxString(v *Value) string {
+	d := fn.d
+	switch v.Op {
+	case OpInt:
+		if v.Aux >= 0 && v.Aux < len(d.ints) {
+			return strconv.Itoa(d.ints[v.Aux])
+		}
+	case OpFloat:
+		if v.Aux >= 0 && v.Aux < len(d.floats) {
+			return strconv.FormatFloat(d.floats[v.Aux], 'g', -1, 64)
+		}
+	case OpBool:
+		return strconv.FormatBool(v.Aux != 0)
+	case OpString, OpBytes:
+		return strconv.Quote(d.pool(v.Op).String(v.Aux))
+	case OpCall0, OpCall1, OpCall2, OpCall3, OpCall4, OpCallN, OpStaticClosure, OpInstanceClosure:
+		return d.FunctionName(v.Aux)
+	case OpGetGlobal, OpSetGlobal:
+		return d.globalName(v.Aux)
+	case OpType:
+		return d.TypeName(d.LookupType(v.Aux))
+	}
+	if v.Aux >= 0 {
+		return "#" + strconv.Itoa(v.Aux)
+	}
+	return ""
+}
+
+// Pass is an analysis or transformation of functions in SSA form
+type Pass interface {
+	Name() string
+	Run(fn *SSAFunc) error
+}
+
+// PassFunc adapts a function to the Pass interface
+type PassFunc struct {
+	PassName string
+	Func     func(fn *SSAFunc) error
+}
+
+func (p PassFunc) Name() string          { return p.PassName }
+func (p PassFunc) Run(fn *SSAFunc) error { return p.Func(fn) }
+
+// PassManager runs a pipeline of passes over functions
+type PassManager struct {
+	passes []Pass
+}
+
+// NewPassManager returns a pass manager running passes in order
+func NewPassManager(passes ...Pass) *PassManager {
+	return &PassManager{passes: passes}
+}
+
+// Add appends p to the pipeline
+func (m *PassManager) Add(p Pass) { m.passes = append(m.passes, p) }
+
+// RunFunc runs the pipeline over fn, stopping at the first error
+func (m *PassManager) RunFunc(fn *SSAFunc) error {
+	for _, p := range m.passes {
+		if err := p.Run(fn); err != nil {
+			return fmt.Errorf("%s: %s: %v", p.Name(), fn.Name, err)
+		}
+	}
+	return nil
+}
+
+// Run converts every bytecode function of d to SSA form in index
+// order and runs the pipeline over each of them.
+func (m *PassManager) Run(d *Data) error {
+	fns := make([]int, len(d.functions))
+	for i, f := range d.functions {
+		fns[i] = f.funcIdx
+	}
+	sort.Ints(fns)
+	for _, i := range fns {
+		if err := m.RunFunc(d.SSA(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
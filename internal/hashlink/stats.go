@@ -0,0 +1,183 @@
+package hashlink
+
+import (
+	"sort"
+	"strings"
+)
+
+// CodeSize is the amount of bytecode owned by a class or package
+type CodeSize struct {
+	Name         string `json:"name"`
+	Functions    int    `json:"functions"`
+	Instructions int    `json:"instructions"`
+}
+
+// FunctionStats describes the size and call graph degree of a function.
+// FanIn counts the distinct functions calling it directly, FanOut the
+// distinct functions it calls directly.
+type FunctionStats struct {
+	FuncRef
+	Instructions int `json:"instructions"`
+	Registers    int `json:"registers"`
+	FanIn        int `json:"fanIn"`
+	FanOut       int `json:"fanOut"`
+}
+
+// NativeCalls is the number of call sites of a native function
+type NativeCalls struct {
+	FuncRef
+	Calls int `json:"calls"`
+}
+
+// StringSize is the part of the string pool loaded by a package
+type StringSize struct {
+	Package string `json:"package"`
+	Strings int    `json:"strings"`
+	Bytes   int    `json:"bytes"`
+}
+
+// Stats holds code size statistics of a module
+type Stats struct {
+	Opcodes     []OpCount       `json:"opcodes"`
+	Classes     []CodeSize      `json:"classes"`
+	Packages    []CodeSize      `json:"packages"`
+	Functions   []FunctionStats `json:"functions"`
+	NativeCalls []NativeCalls   `json:"nativeCalls"`
+	Strings     []StringSize    `json:"strings"`
+}
+
+// Names used for code outside of any class or package, and for
+// strings not loaded by any function
+const (
+	NoClass      = "-"
+	NoPackage    = "-"
+	UnusedString = "(unused)"
+)
+
+// className returns the name of the class owning f. Statics are
+// counted with their class, dropping the $ of the static class name.
+func (d *Data) className(f *hlFunction) string {
+	if t, ok := f.obj.(*ObjType); ok {
+		return strings.TrimPrefix(d.strings.String(t.nameIdx), "$")
+	}
+	return NoClass
+}
+
+// packageName returns the package part of a dotted class path
+func packageName(class string) string {
+	if i := strings.LastIndexByte(class, '.'); i > 0 {
+		return class[:i]
+	}
+	return NoPackage
+}
+
+// Stats computes code size statistics. A string is counted once for
+// every package loading it, strings never loaded are reported under
+// UnusedString. Lists are sorted by descending size, functions by index.
+// Resolve must have been called beforehand.
+func (d *Data) Stats() *Stats {
+	s := &Stats{Opcodes: d.opcodeHistogram(d.functions)}
+
+	classes := make(map[string]*CodeSize)
+	packages := make(map[string]*CodeSize)
+	add := func(m map[string]*CodeSize, name string, n int) {
+		c, ok := m[name]
+		if !ok {
+			c = &CodeSize{Name: name}
+			m[name] = c
+		}
+		c.Functions++
+		c.Instructions += n
+	}
+
+	fanIn := make(map[int]int)
+	natives := make(map[int]int)
+	strs := make(map[string]map[int]bool)
+	loaded := make(map[int]bool)
+	s.Functions = make([]FunctionStats, len(d.functions))
+	for i, f := range d.functions {
+		class := d.className(f)
+		pkg := packageName(class)
+		add(classes, class, f.nInst)
+		add(packages, pkg, f.nInst)
+
+		callees := make(map[int]bool)
+		code := f.code()
+		for j := range code {
+			o := &code[j]
+			if tgt, ok := o.directCall(); ok {
+				if _, ok := d.LookupFunction(tgt).(*hlNative); ok {
+					natives[tgt]++
+				}
+				callees[tgt] = true
+			}
+			if o.op == OpString {
+				if strs[pkg] == nil {
+					strs[pkg] = make(map[int]bool)
+				}
+				strs[pkg][o.args()[1]] = true
+				loaded[o.args()[1]] = true
+			}
+		}
+		for tgt := range callees {
+			fanIn[tgt]++
+		}
+		s.Functions[i] = FunctionStats{
+			FuncRef:      FuncRef{f.funcIdx, d.FunctionName(f.funcIdx)},
+			Instructions: f.nInst,
+			Registers:    len(f.regIdx),
+			FanOut:       len(callees),
+		}
+	}
+	for i := range s.Functions {
+		s.Functions[i].FanIn = fanIn[s.Functions[i].Index]
+	}
+	sort.Slice(s.Functions, func(i, j int) bool { return s.Functions[i].Index < s.Functions[j].Index })
+
+	s.Classes = sortedSizes(classes)
+	s.Packages = sortedSizes(packages)
+
+	for _, n := range d.natives {
+		if c := natives[n.funcIdx]; c > 0 {
+			s.NativeCalls = append(s.NativeCalls, NativeCalls{FuncRef{n.funcIdx, d.FunctionName(n.funcIdx)}, c})
+		}
+	}
+	sort.SliceStable(s.NativeCalls, func(i, j int) bool { return s.NativeCalls[i].Calls > s.NativeCalls[j].Calls })
+
+	for i := range d.strings.index {
+		if !loaded[i] {
+			if strs[UnusedString] == nil {
+				strs[UnusedString] = make(map[int]bool)
+			}
+			strs[UnusedString][i] = true
+		}
+	}
+	for pkg, idx := range strs {
+		sz := StringSize{Package: pkg, Strings: len(idx)}
+		for i := range idx {
+			sz.Bytes += len(d.strings.Bytes(i))
+		}
+		s.Strings = append(s.Strings, sz)
+	}
+	sort.Slice(s.Strings, func(i, j int) bool {
+		if s.Strings[i].Bytes != s.Strings[j].Bytes {
+			return s.Strings[i].Bytes > s.Strings[j].Bytes
+		}
+		return s.Strings[i].Package < s.Strings[j].Package
+	})
+	return s
+}
+
+func sortedSizes(m map[string]*CodeSize) []CodeSize {
+	res := make([]CodeSize, 0, len(m))
+	for _, c := range m {
+		res = append(res, *c)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Instructions != res[j].Instructions {
+			return res[i].Instructions > res[j].Instructions
+		}
+		return res[i].Name < res[j].Name
+	})
+	return res
+}
@@ -0,0 +1,76 @@
+package hashlink
+
+import (
+	"strconv"
+)
+
+// Constant pools holding string data
+const (
+	PoolStrings = "strings"
+	PoolBytes   = "bytes"
+)
+
+// StringInfo describes an entry of the string or bytes pool. Value
+// is the Go quoted content.
+type StringInfo struct {
+	Pool     string    `json:"pool"`
+	Index    int       `json:"index"`
+	Length   int       `json:"length"`
+	Value    string    `json:"value"`
+	LoadedBy []FuncRef `json:"loadedBy,omitempty"`
+}
+
+// Pool returns the named constant pool, or nil if unknown
+func (d *Data) Pool(name string) *StringContainer {
+	switch name {
+	case PoolStrings:
+		return &d.strings
+	case PoolBytes:
+		return &d.bytes
+	}
+	return nil
+}
+
+// FindStrings returns the entries of the named pool accepted by match,
+// or all entries if match is nil. With xref set each entry lists the
+// functions loading it through OpString or OpBytes. Resolve must have
+// been called beforehand.
+func (d *Data) FindStrings(pool string, match func(b []byte) bool, xref bool) []StringInfo {
+	c := d.Pool(pool)
+	if c == nil {
+		return nil
+	}
+
+	var res []StringInfo
+	found := make(map[int]int)
+	c.Range(func(i int, b []byte) bool {
+		if match == nil || match(b) {
+			found[i] = len(res)
+			res = append(res, StringInfo{Pool: pool, Index: i, Length: len(b), Value: strconv.Quote(string(b))})
+		}
+		return true
+	})
+	if !xref {
+		return res
+	}
+
+	for _, f := range d.functions {
+		code := f.code()
+		for j := range code {
+			o := &code[j]
+			if (o.op != OpString && o.op != OpBytes) || d.pool(o.op) != c {
+				continue
+			}
+			k, ok := found[o.args()[1]]
+			if !ok {
+				continue
+			}
+			s := &res[k]
+			if n := len(s.LoadedBy); n > 0 && s.LoadedBy[n-1].Index == f.funcIdx {
+				continue
+			}
+			s.LoadedBy = append(s.LoadedBy, FuncRef{f.funcIdx, d.FunctionName(f.funcIdx)})
+		}
+	}
+	return res
+}
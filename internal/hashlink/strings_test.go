@@ -0,0 +1,62 @@
+package hashlink
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// escapeModule encodes a module whose only function loads a string
+// holding control characters
+func escapeModule(s string) []byte {
+	var w hlbWriter
+	w.WriteString(Magic)
+	w.WriteByte(4)
+	w.index(0) // flags
+	w.index(0) // ints
+	w.index(0) // floats
+	w.index(1) // strings
+	w.index(3) // types
+	w.index(0) // globals
+	w.index(0) // natives
+	w.index(1) // functions
+	w.index(0) // constants
+	w.index(0) // entry point
+
+	w.stringBlock([][]byte{[]byte(s)})
+
+	w.WriteByte(byte(VoidT))
+	w.WriteByte(byte(BytesT))
+	w.WriteByte(byte(FunT))
+	w.WriteByte(0)
+	w.index(0)
+
+	w.index(2)
+	w.index(0)
+	w.index(2)
+	w.index(2)
+	w.index(1)
+	w.index(0)
+	w.WriteByte(byte(OpString))
+	w.index(0)
+	w.index(0)
+	w.WriteByte(byte(OpRet))
+	w.index(1)
+	return w.Bytes()
+}
+
+func TestFindStrings(t *testing.T) {
+	const s = "a\x1b[2J\n"
+	d, err := NewData(escapeModule(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Resolve()
+	l := d.FindStrings(PoolStrings, nil, true)
+	if len(l) != 1 || l[0].Value != strconv.Quote(s) || len(l[0].LoadedBy) != 1 {
+		t.Fatalf("found %+v", l)
+	}
+	if text := d.Listing(0)[0].Text; !strings.Contains(text, l[0].Value) {
+		t.Errorf("listing %q does not contain %s", text, l[0].Value)
+	}
+}
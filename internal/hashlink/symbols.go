@@ -0,0 +1,304 @@
+package hashlink
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Symbol is a user assigned name and comment
+type Symbol struct {
+	Name    string `json:"name,omitempty"`
+	Comment string `json:"comment,omitempty"`
+}
+
+// SymbolMap assigns names and comments to functions, globals and
+// types by index, and to registers by function and register index.
+type SymbolMap struct {
+	Functions map[int]*Symbol         `json:"functions,omitempty"`
+	Globals   map[int]*Symbol         `json:"globals,omitempty"`
+	Types     map[int]*Symbol         `json:"types,omitempty"`
+	Registers map[int]map[int]*Symbol `json:"registers,omitempty"`
+}
+
+// Symbol map file formats
+const (
+	FormatJSON = "json"
+	FormatTOML = "toml"
+)
+
+// NewSymbolMap returns an empty symbol map
+func NewSymbolMap() *SymbolMap {
+	return &SymbolMap{
+		Functions: make(map[int]*Symbol),
+		Globals:   make(map[int]*Symbol),
+		Types:     make(map[int]*Symbol),
+		Registers: make(map[int]map[int]*Symbol),
+	}
+}
+
+func (m *SymbolMap) function(i int) *Symbol {
+	if m == nil {
+		return nil
+	}
+	return m.Functions[i]
+}
+
+func (m *SymbolMap) global(i int) *Symbol {
+	if m == nil {
+		return nil
+	}
+	return m.Globals[i]
+}
+
+func (m *SymbolMap) register(f, r int) *Symbol {
+	if m == nil {
+		return nil
+	}
+	return m.Registers[f][r]
+}
+
+// SetFunction names function i
+func (m *SymbolMap) SetFunction(i int, s Symbol) { m.Functions[i] = &s }
+
+// SetGlobal names global i
+func (m *SymbolMap) SetGlobal(i int, s Symbol) { m.Globals[i] = &s }
+
+// SetType names type i
+func (m *SymbolMap) SetType(i int, s Symbol) { m.Types[i] = &s }
+
+// SetRegister names register r of function f
+func (m *SymbolMap) SetRegister(f, r int, s Symbol) {
+	if m.Registers[f] == nil {
+		m.Registers[f] = make(map[int]*Symbol)
+	}
+	m.Registers[f][r] = &s
+}
+
+// SetSymbols attaches a symbol map to the module. Names in the map
+// take precedence over names derived from the module itself.
+func (d *Data) SetSymbols(m *SymbolMap) {
+	d.symbols = m
+	d.funcNames = nil
+	d.typeSymbols = make(map[hlType]*Symbol)
+	if m == nil {
+		return
+	}
+	for i, s := range m.Types {
+		if i >= 0 && i < len(d.types) {
+			d.typeSymbols[d.types[i]] = s
+		}
+	}
+}
+
+// Symbols returns the attached symbol map, if any
+func (d *Data) Symbols() *SymbolMap { return d.symbols }
+
+// FunctionComment returns the user comment of function i
+func (d *Data) FunctionComment(i int) string {
+	if s := d.symbols.function(i); s != nil {
+		return s.Comment
+	}
+	return ""
+}
+
+// ExportSymbols returns a symbol map holding the attached symbols
+// together with the names known from the module itself: method and
+// native names, anonymous functions named after their creator, the
+// classes backing globals and, for modules with debug information,
+// local variable names of registers.
+func (d *Data) ExportSymbols() *SymbolMap {
+	m := NewSymbolMap()
+	for _, f := range d.functions {
+		if _, anon := d.lambdaOf(f.funcIdx); f.obj != nil || anon {
+			m.SetFunction(f.funcIdx, Symbol{Name: d.FunctionName(f.funcIdx)})
+		}
+		for _, a := range f.assigns {
+			if r := f.assignReg(a); r >= 0 {
+				m.SetRegister(f.funcIdx, r, Symbol{Name: d.strings.String(a.nameIdx)})
+			}
+		}
+	}
+	for _, n := range d.natives {
+		m.SetFunction(n.funcIdx, Symbol{Name: d.FunctionName(n.funcIdx)})
+	}
+	for i := range d.globals {
+		if d.globalOwner[i] != nil {
+			m.SetGlobal(i, Symbol{Name: d.globalName(i)})
+		}
+	}
+
+	if d.symbols == nil {
+		return m
+	}
+	for i, s := range d.symbols.Functions {
+		m.SetFunction(i, *s)
+	}
+	for i, s := range d.symbols.Globals {
+		m.SetGlobal(i, *s)
+	}
+	for i, s := range d.symbols.Types {
+		m.SetType(i, *s)
+	}
+	for f, regs := range d.symbols.Registers {
+		for r, s := range regs {
+			m.SetRegister(f, r, *s)
+		}
+	}
+	return m
+}
+
+// ReadSymbols decodes a symbol map in the given format
+func ReadSymbols(r io.Reader, format string) (*SymbolMap, error) {
+	m := NewSymbolMap()
+	switch format {
+	case FormatJSON:
+		if err := json.NewDecoder(r).Decode(m); err != nil {
+			return nil, err
+		}
+	case FormatTOML:
+		if err := m.readTOML(r); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, ErrSymbolFormat
+	}
+	return m, nil
+}
+
+// Write encodes the symbol map in the given format
+func (m *SymbolMap) Write(w io.Writer, format string) error {
+	switch format {
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		return enc.Encode(m)
+	case FormatTOML:
+		return m.writeTOML(w)
+	}
+	return ErrSymbolFormat
+}
+
+// The TOML form uses one table per symbol, eg.
+//
+//	[functions.12]
+//	name = "Player.update"
+//	comment = "called every frame"
+//
+//	[registers.12.3]
+//	name = "dt"
+func (m *SymbolMap) writeTOML(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	write := func(key string, s *Symbol) {
+		fmt.Fprintf(bw, "[%s]\n", key)
+		if s.Name != "" {
+			fmt.Fprintf(bw, "name = %s\n", strconv.Quote(s.Name))
+		}
+		if s.Comment != "" {
+			fmt.Fprintf(bw, "comment = %s\n", strconv.Quote(s.Comment))
+		}
+		fmt.Fprintln(bw)
+	}
+	for _, sec := range []struct {
+		name string
+		syms map[int]*Symbol
+	}{{"functions", m.Functions}, {"globals", m.Globals}, {"types", m.Types}} {
+		for _, i := range sortedInts(sec.syms) {
+			write(sec.name+"."+strconv.Itoa(i), sec.syms[i])
+		}
+	}
+	fns := make([]int, 0, len(m.Registers))
+	for f := range m.Registers {
+		fns = append(fns, f)
+	}
+	sort.Ints(fns)
+	for _, f := range fns {
+		for _, r := range sortedInts(m.Registers[f]) {
+			write("registers."+strconv.Itoa(f)+"."+strconv.Itoa(r), m.Registers[f][r])
+		}
+	}
+	return bw.Flush()
+}
+
+func sortedInts(m map[int]*Symbol) []int {
+	res := make([]int, 0, len(m))
+	for i := range m {
+		res = append(res, i)
+	}
+	sort.Ints(res)
+	return res
+}
+
+// readTOML parses the subset of TOML produced by writeTOML: tables
+// with dotted integer keys holding basic string values.
+func (m *SymbolMap) readTOML(r io.Reader) error {
+	var cur *Symbol
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		if line[0] == '[' {
+			if line[len(line)-1] != ']' {
+				return fmt.Errorf("line %d: %v", n, ErrSymbolSyntax)
+			}
+			s, err := m.table(strings.Split(line[1:len(line)-1], "."))
+			if err != nil {
+				return fmt.Errorf("line %d: %v", n, err)
+			}
+			cur = s
+			continue
+		}
+
+		eq := strings.IndexByte(line, '=')
+		if eq < 0 || cur == nil {
+			return fmt.Errorf("line %d: %v", n, ErrSymbolSyntax)
+		}
+		val, err := strconv.Unquote(strings.TrimSpace(line[eq+1:]))
+		if err != nil {
+			return fmt.Errorf("line %d: %v", n, ErrSymbolSyntax)
+		}
+		switch strings.TrimSpace(line[:eq]) {
+		case "name":
+			cur.Name = val
+		case "comment":
+			cur.Comment = val
+		}
+	}
+	return sc.Err()
+}
+
+// table returns the symbol addressed by a dotted TOML table key
+func (m *SymbolMap) table(key []string) (*Symbol, error) {
+	idx := make([]int, len(key)-1)
+	for i := range idx {
+		v, err := strconv.Atoi(strings.TrimSpace(key[i+1]))
+		if err != nil {
+			return nil, ErrSymbolSyntax
+		}
+		idx[i] = v
+	}
+
+	s := new(Symbol)
+	switch {
+	case key[0] == "functions" && len(idx) == 1:
+		m.Functions[idx[0]] = s
+	case key[0] == "globals" && len(idx) == 1:
+		m.Globals[idx[0]] = s
+	case key[0] == "types" && len(idx) == 1:
+		m.Types[idx[0]] = s
+	case key[0] == "registers" && len(idx) == 2:
+		m.SetRegister(idx[0], idx[1], Symbol{})
+		s = m.Registers[idx[0]][idx[1]]
+	default:
+		return nil, ErrSymbolSyntax
+	}
+	return s, nil
+}
@@ -0,0 +1,76 @@
+package hashlink
+
+// Types of the synthetic module
+const (
+	synVoid = iota
+	synI32
+	synFun
+)
+
+// synCode is the instruction pattern repeated in synthetic functions,
+// covering fixed operands, call arguments and switch targets.
+var synCode = [][]int{
+	{int(OpInt), 0, 0},
+	{int(OpAdd), 1, 0, 0},
+	{int(OpJSLt), 0, 1, 0},
+	{int(OpCall0), 3, 0},
+	{int(OpSetGlobal), 0, 1},
+	{int(OpCallN), 3, 0, 2, 0, 1},
+	{int(OpSwitch), 0, 2, 0, 0, 0},
+	{int(OpIncr), 2},
+}
+
+// syntheticModule encodes a valid module of nFunc functions with
+// nInst instructions each, for measuring the decoder on large inputs.
+func syntheticModule(nFunc, nInst int) []byte {
+	var w hlbWriter
+	w.WriteString(Magic)
+	w.WriteByte(4)
+	w.index(0) // flags
+	w.index(1) // ints
+	w.index(0) // floats
+	w.index(1) // strings
+	w.index(3) // types
+	w.index(1) // globals
+	w.index(0) // natives
+	w.index(nFunc)
+	w.index(0) // constants
+	w.index(0) // entry point
+
+	w.int32(1)
+	w.int32(2)
+	w.WriteString("s\x00")
+	w.index(1)
+
+	w.WriteByte(byte(VoidT))
+	w.WriteByte(byte(I32T))
+	w.WriteByte(byte(FunT))
+	w.WriteByte(0)
+	w.index(synVoid)
+
+	w.index(synI32)
+
+	for i := 0; i < nFunc; i++ {
+		w.index(synFun)
+		w.index(i)
+		w.index(4)
+		w.index(nInst)
+		for _, r := range []int{synI32, synI32, synI32, synVoid} {
+			w.index(r)
+		}
+		for j := 0; j < nInst-1; j++ {
+			op := synCode[j%len(synCode)]
+			w.WriteByte(byte(op[0]))
+			for k, v := range op[1:] {
+				if op[0] == int(OpCallN) && k == 2 {
+					w.WriteByte(byte(v))
+					continue
+				}
+				w.index(v)
+			}
+		}
+		w.WriteByte(byte(OpRet))
+		w.index(3)
+	}
+	return w.Bytes()
+}
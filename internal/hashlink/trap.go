@@ -0,0 +1,95 @@
+package hashlink
+
+import (
+	"sort"
+)
+
+// TryRegion is the code protected by an OpTrap. Start and End bound
+// the protected instructions, inclusive. Control reaches Handler with
+// the exception in register Reg when any of them raises an exception.
+// EndTraps lists the OpEndTrap instructions leaving the region.
+type TryRegion struct {
+	Trap     int   `json:"trap"`
+	Start    int   `json:"start"`
+	End      int   `json:"end"`
+	Handler  int   `json:"handler"`
+	Reg      int   `json:"reg"`
+	EndTraps []int `json:"endTraps,omitempty"`
+
+	// Protected instructions not inside a nested region
+	body []int
+}
+
+// TryRegions returns the try regions of function fn ordered by their
+// OpTrap instruction, or nil if fn is not a bytecode function.
+func (d *Data) TryRegions(fn int) []TryRegion {
+	f, ok := d.LookupFunction(fn).(*hlFunction)
+	if !ok {
+		return nil
+	}
+	return tryRegions(f.code())
+}
+
+// tryRegions follows the control flow from each OpTrap, tracking
+// the depth of nested traps, until the matching OpEndTrap is reached.
+// Code is not assumed to be laid out in order as an OpEndTrap is
+// emitted on every path leaving the region, eg. before a return.
+func tryRegions(code []HilInst) []TryRegion {
+	var res []TryRegion
+	for pc := range code {
+		if code[pc].op != OpTrap {
+			continue
+		}
+		a := code[pc].args()
+		r := TryRegion{Trap: pc, Start: pc + 1, End: pc, Handler: jumpTarget(pc, a[1]), Reg: a[0]}
+		if r.Handler < 0 || r.Handler >= len(code) {
+			continue
+		}
+
+		type state struct{ pc, depth int }
+		seen := make(map[state]bool)
+		body := make(map[int]bool)
+		work := []state{{pc + 1, 0}}
+		for len(work) > 0 {
+			s := work[len(work)-1]
+			work = work[:len(work)-1]
+			if s.pc < 0 || s.pc >= len(code) || seen[s] {
+				continue
+			}
+			seen[s] = true
+			if s.pc > r.End {
+				r.End = s.pc
+			}
+			if s.depth == 0 {
+				body[s.pc] = true
+			}
+
+			o := &code[s.pc]
+			switch o.op {
+			case OpEndTrap:
+				if s.depth == 0 {
+					r.EndTraps = append(r.EndTraps, s.pc)
+					continue
+				}
+				work = append(work, state{s.pc + 1, s.depth - 1})
+				continue
+			case OpTrap:
+				// The nested handler still runs inside this region
+				work = append(work, state{s.pc + 1, s.depth + 1})
+				work = append(work, state{jumpTarget(s.pc, o.args()[1]), s.depth})
+				continue
+			}
+			for _, t := range successors(code, s.pc) {
+				work = append(work, state{t, s.depth})
+			}
+		}
+
+		sort.Ints(r.EndTraps)
+		for i := range body {
+			r.body = append(r.body, i)
+		}
+		sort.Ints(r.body)
+		res = append(res, r)
+	}
+	return res
+}
@@ -0,0 +1,30 @@
+package hashlink
+
+// directCall returns the index of the function called by o
+// when the target is encoded in the instruction itself.
+func (o *HilInst) directCall() (int, bool) {
+	switch o.op {
+	case OpCall0, OpCall1, OpCall2, OpCall3, OpCall4, OpCallN:
+		return o.args()[1], true
+	}
+	return 0, false
+}
+
+// Callers maps function indexes to the bytecode functions that may
+// call them, directly or through the call sites resolved by CallSites.
+// Each caller is listed once, in function order.
+func (d *Data) Callers() map[int][]int {
+	res := make(map[int][]int)
+	for _, f := range d.functions {
+		for _, site := range d.callSites(f, d.analyze(f)) {
+			for _, tgt := range site.Targets {
+				l := res[tgt.Index]
+				if len(l) > 0 && l[len(l)-1] == f.funcIdx {
+					continue
+				}
+				res[tgt.Index] = append(l, f.funcIdx)
+			}
+		}
+	}
+	return res
+}
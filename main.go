@@ -1,53 +1,605 @@
 package main
 
 import (
+	"bufio"
+	"encoding/json"
+	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
 )
 
 import (
 	hl "github.com/c0rner/hldump/internal/hashlink"
 )
 
-func FindHLB(b []byte) []byte {
-	for i := 0; i < len(b); i++ {
-		for j := 0; j < len(hl.Magic); j++ {
-			if b[i+j] != hl.Magic[j] {
-				break
+// Command is a hldump sub command
+type Command struct {
+	Usage string
+	Run   func(args []string) error
+}
+
+var commands map[string]*Command
+
+func init() {
+	commands = map[string]*Command{
+		"calls":     {"[-symbols file] [-json] [-indirect] file.hl [function]", runCalls},
+		"closures":  {"[-symbols file] [-json] file.hl", runClosures},
+		"dead":      {"[-symbols file] [-json] [-strip out.hl] file.hl", runDead},
+		"export":    {"[-symbols file] [-format ghidra|idc|json] [-ptr 4|8] [-o file] file.hl", runExport},
+		"diff":      {"[-old-symbols file] [-new-symbols file] [-json] old.hl new.hl", runDiff},
+		"dump":      {"[-symbols file] [file.hl]", runDump},
+		"externs":   {"[-symbols file] [-std] [-o dir] file.hl", runExterns},
+		"globals":   {"[-symbols file] [-json] file.hl", runGlobals},
+		"info":      {"[-symbols file] [-json] [-top n] file.hl", runInfo},
+		"match":     {"[-old-symbols file] [-new-symbols file] [-json] old.hl new.hl", runMatch},
+		"natives":   {"[-symbols file] [-json] file.hl", runNatives},
+		"ssa":       {"[-symbols file] file.hl [function]", runSSA},
+		"serve":     {"[-symbols file] [-addr host:port] file.hl", runServe},
+		"stats":     {"[-symbols file] [-json|-csv] [-table name] file.hl", runStats},
+		"strings":   {"[-symbols file] [-json] [-pool strings|bytes|all] [-match regexp] [-min n] [-xref] file.hl", runStrings},
+		"symbolize": {"[-symbols file] file.hl < trace.txt", runSymbolize},
+		"symbols":   {"[-symbols file] [-o out.json|out.toml] file.hl", runSymbols},
+		"tui":       {"[-symbols file] file.hl", runTUI},
+		"where":     {"[-symbols file] [-json] file.hl file.hx:line|fun@N:pc", runWhere},
+	}
+}
+
+// symbolFile is the optional symbol map applied by LoadHLB
+var symbolFile string
+
+// workers is the number of goroutines used by LoadCode
+var workers int
+
+// newFlagSet returns a flag set holding the options common to all commands
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.StringVar(&symbolFile, "symbols", "", "symbol map `file` (.json or .toml)")
+	fs.IntVar(&workers, "workers", runtime.NumCPU(), "number of goroutines decoding functions")
+	return fs
+}
+
+// symbolFormat guesses the symbol map format from a file name
+func symbolFormat(name string) string {
+	if strings.HasSuffix(name, ".toml") {
+		return hl.FormatTOML
+	}
+	return hl.FormatJSON
+}
+
+func loadSymbols(name string) (*hl.SymbolMap, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return hl.ReadSymbols(f, symbolFormat(name))
+}
+
+// FindHLB advances r to the start of the HLB module it contains
+func FindHLB(r *bufio.Reader) error {
+	for {
+		b, err := r.Peek(len(hl.Magic))
+		if err != nil {
+			if err == io.EOF {
+				return hl.ErrNotValidHLB
 			}
-			if j == len(hl.Magic)-1 {
-				return b[i:]
+			return err
+		}
+		if string(b) == hl.Magic {
+			return nil
+		}
+		r.Discard(1)
+	}
+}
+
+// LoadHLB reads and resolves the HLB module found in file name, or
+// on stdin if name is "-". Function bodies are decoded on first use.
+func LoadHLB(name string) (*hl.Data, error) {
+	return loadHLB(name, symbolFile)
+}
+
+// loadHLB is LoadHLB applying the symbol map in file symbols, if any
+func loadHLB(name, symbols string) (*hl.Data, error) {
+	opt := &hl.Options{LazyCode: true}
+
+	var hlb *hl.Data
+	var err error
+	if name == "-" {
+		r := bufio.NewReaderSize(os.Stdin, 64*1024)
+		if err := FindHLB(r); err != nil {
+			return nil, err
+		}
+		hlb, err = hl.ParseOptions(r, opt)
+	} else {
+		hlb, err = hl.Open(name, opt)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	hlb.Resolve()
+	if symbols != "" {
+		syms, err := loadSymbols(symbols)
+		if err != nil {
+			hlb.Close()
+			return nil, err
+		}
+		hlb.SetSymbols(syms)
+	}
+	return hlb, nil
+}
+
+// LoadCode is LoadHLB for commands using every function body,
+// which are decoded up front in parallel.
+func LoadCode(name string) (*hl.Data, error) {
+	return loadCode(name, symbolFile)
+}
+
+func loadCode(name, symbols string) (*hl.Data, error) {
+	hlb, err := loadHLB(name, symbols)
+	if err != nil {
+		return nil, err
+	}
+	if err := hlb.DecodeFunctions(workers); err != nil {
+		hlb.Close()
+		return nil, err
+	}
+	return hlb, nil
+}
+
+// buildFlags adds the symbol map options of commands comparing two
+// builds. Symbol maps are keyed by indexes specific to one build so
+// each build takes its own, -symbols being the map of the old one.
+func buildFlags(fs *flag.FlagSet) (oldSymbols, newSymbols *string) {
+	oldSymbols = fs.String("old-symbols", "", "symbol map `file` of the old build")
+	newSymbols = fs.String("new-symbols", "", "symbol map `file` of the new build")
+	return oldSymbols, newSymbols
+}
+
+// loadBuilds loads the old and new builds compared by a command
+func loadBuilds(oldName, newName, oldSymbols, newSymbols string) (*hl.Data, *hl.Data, error) {
+	if oldSymbols == "" {
+		oldSymbols = symbolFile
+	}
+	a, err := loadCode(oldName, oldSymbols)
+	if err != nil {
+		return nil, nil, err
+	}
+	b, err := loadCode(newName, newSymbols)
+	if err != nil {
+		a.Close()
+		return nil, nil, err
+	}
+	return a, b, nil
+}
+
+// writeJSON encodes v as indented JSON on stdout
+func writeJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(v)
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: hldump <command> [arguments]\n\nCommands:\n")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "\t%s %s\n", name, commands[name].Usage)
+	}
+	os.Exit(2)
+}
+
+func runDump(args []string) error {
+	fs := newFlagSet("dump")
+	fs.Parse(args)
+
+	fmt.Printf("HL Dump\n")
+
+	name := "data/helloworld.hl"
+	if fs.NArg() > 0 {
+		name = fs.Arg(0)
+	}
+	hlb, err := LoadCode(name)
+	if err != nil {
+		return err
+	}
+	defer hlb.Close()
+	hlb.Dump()
+	return nil
+}
+
+func runGlobals(args []string) error {
+	fs := newFlagSet("globals")
+	asJSON := fs.Bool("json", false, "output JSON")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		usage()
+	}
+
+	hlb, err := LoadCode(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer hlb.Close()
+
+	globals := hlb.Globals()
+	if *asJSON {
+		return writeJSON(globals)
+	}
+	for _, g := range globals {
+		fmt.Printf("@%d %s", g.Index, g.Type)
+		if g.Name != "" {
+			fmt.Printf(" %s", g.Name)
+		}
+		if g.Owner != "" {
+			fmt.Printf(" (%s %s)", g.OwnerKind, g.Owner)
+		}
+		if g.Comment != "" {
+			fmt.Printf(" ; %s", g.Comment)
+		}
+		fmt.Println()
+		for _, f := range g.InitBy {
+			fmt.Printf("\tinit: %s fun@%d\n", f.Name, f.Index)
+		}
+		for _, c := range g.Constant {
+			fmt.Printf("\tconst %s:%s = %s\n", c.Name, c.Type, c.Value)
+		}
+	}
+	return nil
+}
+
+func runNatives(args []string) error {
+	fs := newFlagSet("natives")
+	asJSON := fs.Bool("json", false, "output JSON")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		usage()
+	}
+
+	hlb, err := LoadCode(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer hlb.Close()
+
+	libs := hlb.Natives()
+	if *asJSON {
+		return writeJSON(libs)
+	}
+	for _, lib := range libs {
+		fmt.Printf("%s (%d)\n", lib.Name, len(lib.Natives))
+		for _, n := range lib.Natives {
+			fmt.Printf("\t@%d %s(%s) -> %s\n", n.Index, n.Name, strings.Join(n.Args, ", "), n.Ret)
+			for _, f := range n.CalledBy {
+				fmt.Printf("\t\tcalled by %s fun@%d\n", f.Name, f.Index)
 			}
 		}
 	}
 	return nil
 }
 
-func main() {
-	fmt.Printf("HL Dump\n")
+func runDead(args []string) error {
+	fs := newFlagSet("dead")
+	asJSON := fs.Bool("json", false, "output JSON")
+	strip := fs.String("strip", "", "write the module without unreachable functions to `file`")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		usage()
+	}
 
-	f, err := os.Open("data/helloworld.hl")
+	hlb, err := LoadCode(fs.Arg(0))
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+	defer hlb.Close()
+
+	if *strip != "" {
+		f, err := os.Create(*strip)
+		if err != nil {
+			return err
+		}
+		if err := hlb.Strip(f); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
 	}
 
-	fs, err := f.Stat()
+	r := hlb.Reachability()
+	if *asJSON {
+		return writeJSON(r)
+	}
+	for _, f := range r.Functions {
+		fmt.Printf("fun@%d %s\n", f.Index, f.Name)
+	}
+	for _, b := range r.Blocks {
+		fmt.Printf("fun@%d %s @%d-@%d\n", b.Index, b.Name, b.Start, b.End)
+	}
+	return nil
+}
+
+func runDiff(args []string) error {
+	fs := newFlagSet("diff")
+	asJSON := fs.Bool("json", false, "output JSON")
+	oldSyms, newSyms := buildFlags(fs)
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		usage()
+	}
+
+	a, b, err := loadBuilds(fs.Arg(0), fs.Arg(1), *oldSyms, *newSyms)
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+	defer a.Close()
+	defer b.Close()
+
+	diff := hl.Diff(a, b)
+	if *asJSON {
+		return writeJSON(diff)
+	}
+	mark := map[string]string{hl.DiffAdded: "+", hl.DiffRemoved: "-", hl.DiffChanged: "~"}
+	for _, e := range diff {
+		fmt.Printf("%s %s %s", mark[e.Change], e.Kind, e.Name)
+		switch {
+		case e.Old != "" && e.New != "":
+			fmt.Printf(": %s -> %s", e.Old, e.New)
+		case e.Old != "":
+			fmt.Printf(": %s", e.Old)
+		case e.New != "":
+			fmt.Printf(": %s", e.New)
+		}
+		fmt.Println()
+		for _, l := range e.Lines {
+			fmt.Printf("\t%s\n", l)
+		}
+	}
+	return nil
+}
+
+func runInfo(args []string) error {
+	fs := newFlagSet("info")
+	asJSON := fs.Bool("json", false, "output JSON")
+	top := fs.Int("top", 10, "number of largest functions to list")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		usage()
 	}
 
-	buf := make([]byte, fs.Size())
-	_, err = f.Read(buf)
+	hlb, err := LoadCode(fs.Arg(0))
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+	defer hlb.Close()
+
+	info := hlb.Info(*top)
+	if *asJSON {
+		return writeJSON(info)
+	}
+	fmt.Printf("Version: %d\nFlags: %x\nDebug: %t\nDebug files: %d\n", info.Version, info.Flags, info.Debug, info.DebugFiles)
+	fmt.Printf("Entry point: %s fun@%d\n", info.EntryPoint.Name, info.EntryPoint.Index)
+	fmt.Printf("Ints: %d\nFloats: %d\nStrings: %d\nBytes: %d\nTypes: %d\nGlobals: %d\nNatives: %d\nFunctions: %d\nConstants: %d\n",
+		info.Ints, info.Floats, info.Strings, info.Bytes, info.Types, info.Globals, info.Natives, info.Functions, info.Constants)
+	fmt.Printf("Sections:\n")
+	for _, s := range info.Sections {
+		fmt.Printf("\t%-12s %d bytes\n", s.Name, s.Size)
+	}
+	fmt.Printf("Instructions: %d\n", info.Instructions)
+	fmt.Printf("Largest functions:\n")
+	for _, f := range info.Largest {
+		fmt.Printf("\t%8d %s fun@%d (%d registers)\n", f.Instructions, f.Name, f.Index, f.Registers)
+	}
+	fmt.Printf("Opcodes:\n")
+	for _, o := range info.Opcodes {
+		fmt.Printf("\t%8d %s\n", o.Count, o.Op)
+	}
+	return nil
+}
+
+func runStrings(args []string) error {
+	fs := newFlagSet("strings")
+	asJSON := fs.Bool("json", false, "output JSON")
+	pool := fs.String("pool", "all", "constant `pool` to list: strings, bytes or all")
+	expr := fs.String("match", "", "only list entries matching `regexp`")
+	min := fs.Int("min", 0, "only list entries of at least `n` bytes")
+	xref := fs.Bool("xref", false, "list the functions loading each entry")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		usage()
+	}
+
+	var re *regexp.Regexp
+	if *expr != "" {
+		var err error
+		if re, err = regexp.Compile(*expr); err != nil {
+			return err
+		}
+	}
+	pools := []string{hl.PoolStrings, hl.PoolBytes}
+	if *pool != "all" {
+		pools = []string{*pool}
 	}
 
-	hlb, err := hl.NewData(FindHLB(buf))
+	var hlb *hl.Data
+	var err error
+	if *xref {
+		hlb, err = LoadCode(fs.Arg(0))
+	} else {
+		hlb, err = LoadHLB(fs.Arg(0))
+	}
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
+	defer hlb.Close()
 
-	hlb.Resolve()
-	hlb.Dump()
+	match := func(b []byte) bool {
+		return len(b) >= *min && (re == nil || re.Match(b))
+	}
+	var res []hl.StringInfo
+	for _, p := range pools {
+		if hlb.Pool(p) == nil {
+			return fmt.Errorf("unknown pool %q", p)
+		}
+		res = append(res, hlb.FindStrings(p, match, *xref)...)
+	}
+
+	if *asJSON {
+		return writeJSON(res)
+	}
+	for _, s := range res {
+		fmt.Printf("%s@%d\t%d\t%s", s.Pool, s.Index, s.Length, s.Value)
+		if *xref {
+			names := make([]string, len(s.LoadedBy))
+			for i, f := range s.LoadedBy {
+				names[i] = f.Name
+			}
+			fmt.Printf("\t%s", strings.Join(names, ", "))
+		}
+		fmt.Println()
+	}
+	return nil
+}
+
+// parseLocation splits a "name:n" argument
+func parseLocation(arg string) (string, int, error) {
+	i := strings.LastIndexByte(arg, ':')
+	if i < 0 {
+		return "", 0, fmt.Errorf("missing line in %q", arg)
+	}
+	n, err := strconv.Atoi(arg[i+1:])
+	if err != nil {
+		return "", 0, fmt.Errorf("bad line in %q", arg)
+	}
+	return arg[:i], n, nil
+}
+
+func runWhere(args []string) error {
+	fs := newFlagSet("where")
+	asJSON := fs.Bool("json", false, "output JSON")
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		usage()
+	}
+
+	name, n, err := parseLocation(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	hlb, err := LoadHLB(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer hlb.Close()
+
+	if strings.HasPrefix(name, "fun@") {
+		fn, err := strconv.Atoi(name[4:])
+		if err != nil {
+			return fmt.Errorf("bad function in %q", fs.Arg(1))
+		}
+		pos, ok := hlb.Position(fn, n)
+		if !ok {
+			return fmt.Errorf("no position for %s", fs.Arg(1))
+		}
+		if *asJSON {
+			return writeJSON(pos)
+		}
+		fmt.Printf("%s %s\n", hlb.FunctionName(fn), pos)
+		return nil
+	}
+
+	if err := hlb.DecodeFunctions(workers); err != nil {
+		return err
+	}
+	res := hlb.FindLine(name, n)
+	if *asJSON {
+		return writeJSON(res)
+	}
+	for _, r := range res {
+		fmt.Printf("%s fun@%d @%d-@%d %s\n", r.Name, r.Index, r.Start, r.End, r.Position)
+	}
+	return nil
+}
+
+func runMatch(args []string) error {
+	fs := newFlagSet("match")
+	asJSON := fs.Bool("json", false, "output JSON")
+	oldSyms, newSyms := buildFlags(fs)
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		usage()
+	}
+
+	a, b, err := loadBuilds(fs.Arg(0), fs.Arg(1), *oldSyms, *newSyms)
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+	defer b.Close()
+
+	matches := hl.MatchFunctions(a, b)
+	if *asJSON {
+		return writeJSON(matches)
+	}
+	for _, m := range matches {
+		fmt.Printf("fun@%d -> fun@%d %.2f %s", m.Old.Index, m.New.Index, m.Score, m.Old.Name)
+		if m.New.Name != m.Old.Name {
+			fmt.Printf(" -> %s", m.New.Name)
+		}
+		fmt.Println()
+	}
+	return nil
+}
+
+func runSymbols(args []string) error {
+	fs := newFlagSet("symbols")
+	out := fs.String("o", "", "write symbol map to `file` instead of stdout")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		usage()
+	}
+
+	hlb, err := LoadHLB(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer hlb.Close()
+
+	if *out == "" {
+		return hlb.ExportSymbols().Write(os.Stdout, symbolFormat(*out))
+	}
+	f, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	if err := hlb.ExportSymbols().Write(f, symbolFormat(*out)); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func main() {
+	log.SetFlags(0)
+	if len(os.Args) < 2 {
+		os.Args = append(os.Args, "dump")
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		usage()
+	}
+	if err := cmd.Run(os.Args[2:]); err != nil {
+		log.Fatal(err)
+	}
 }
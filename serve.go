@@ -0,0 +1,591 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+import (
+	hl "github.com/c0rner/hldump/internal/hashlink"
+)
+
+// maxResults caps the entries of each kind listed by a search
+const maxResults = 200
+
+// server is the HTML viewer of a module. Everything that only depends
+// on the module is computed up front. Requests are served one at a
+// time as Data is not safe for concurrent use.
+type server struct {
+	mu      sync.Mutex
+	hlb     *hl.Data
+	file    string
+	tmpl    *template.Template
+	handler http.Handler
+
+	info       *hl.Info
+	types      []hl.TypeInfo
+	classes    map[int]*hl.ClassInfo
+	subclasses map[int][]int
+	owner      map[int]int // function to class type
+	functions  []hl.FuncRef
+	natives    []hl.NativeLib
+	native     map[int]bool
+	globals    []hl.GlobalInfo
+	strs       map[string][]hl.StringInfo
+	callers    map[int][]int
+	refs       map[hl.Entity][]hl.FuncRef
+	closures   map[int]hl.ClosureInfo
+}
+
+func newServer(hlb *hl.Data, file string) *server {
+	s := &server{
+		hlb:        hlb,
+		file:       file,
+		info:       hlb.Info(20),
+		types:      hlb.Types(),
+		classes:    make(map[int]*hl.ClassInfo),
+		subclasses: make(map[int][]int),
+		owner:      make(map[int]int),
+		functions:  hlb.Functions(),
+		natives:    hlb.Natives(),
+		native:     make(map[int]bool),
+		globals:    hlb.Globals(),
+		strs:       make(map[string][]hl.StringInfo),
+		callers:    hlb.Callers(),
+		refs:       hlb.References(),
+		closures:   make(map[int]hl.ClosureInfo),
+	}
+	for _, c := range hlb.Classes() {
+		c := c
+		s.classes[c.Type] = &c
+		if c.SuperType > 0 {
+			s.subclasses[c.SuperType] = append(s.subclasses[c.SuperType], c.Type)
+		}
+		for _, m := range c.Methods {
+			s.owner[m.Index] = c.Type
+		}
+	}
+	for _, lib := range s.natives {
+		for _, n := range lib.Natives {
+			s.native[n.Index] = true
+		}
+	}
+	for _, pool := range []string{hl.PoolStrings, hl.PoolBytes} {
+		s.strs[pool] = hlb.FindStrings(pool, nil, false)
+	}
+	for _, c := range hlb.Closures() {
+		s.closures[c.Index] = c
+	}
+	s.tmpl = template.Must(template.New("").Funcs(template.FuncMap{
+		"fun":    s.funLink,
+		"typ":    s.typeLink,
+		"global": s.globalLink,
+		"str":    s.stringLink,
+	}).Parse(serveTemplates))
+	s.handler = s.mux()
+	return s
+}
+
+// link formats the operands of instructions as hyperlinks
+func (s *server) link(e hl.Entity, text string) string {
+	text = template.HTMLEscapeString(text)
+	switch e.Kind {
+	case hl.EntityType:
+		return fmt.Sprintf(`<a class="type" href="/type/%d">%s</a>`, e.Index, text)
+	case hl.EntityFunction:
+		class := "fun"
+		if s.native[e.Index] {
+			class = "native"
+		}
+		return fmt.Sprintf(`<a class="%s" href="/fun/%d">%s</a>`, class, e.Index, text)
+	case hl.EntityGlobal:
+		return fmt.Sprintf(`<a class="global" href="/global/%d">%s</a>`, e.Index, text)
+	case hl.EntityString:
+		return fmt.Sprintf(`<a class="str" href="/string/%s/%d">%s</a>`, hl.PoolStrings, e.Index, text)
+	case hl.EntityBytes:
+		return fmt.Sprintf(`<a class="str" href="/string/%s/%d">%s</a>`, hl.PoolBytes, e.Index, text)
+	}
+	return text
+}
+
+func (s *server) funLink(r hl.FuncRef) template.HTML {
+	return template.HTML(s.link(hl.Entity{Kind: hl.EntityFunction, Index: r.Index}, r.Name))
+}
+
+func (s *server) typeLink(i int) template.HTML {
+	if i < 0 || i >= len(s.types) {
+		return "?"
+	}
+	return template.HTML(s.link(hl.Entity{Kind: hl.EntityType, Index: i}, s.types[i].Name))
+}
+
+func (s *server) globalLink(i int) template.HTML {
+	return template.HTML(s.link(hl.Entity{Kind: hl.EntityGlobal, Index: i}, s.globalName(i)))
+}
+
+func (s *server) stringLink(si hl.StringInfo) template.HTML {
+	kind := hl.EntityString
+	if si.Pool == hl.PoolBytes {
+		kind = hl.EntityBytes
+	}
+	return template.HTML(s.link(hl.Entity{Kind: kind, Index: si.Index}, si.Value))
+}
+
+// globalName names global i by symbol, else by the type it backs
+func (s *server) globalName(i int) string {
+	if i < 0 || i >= len(s.globals) {
+		return "global@" + strconv.Itoa(i)
+	}
+	if g := s.globals[i]; g.Name != "" {
+		return g.Name
+	} else if g.Owner != "" {
+		return g.Owner
+	}
+	return "global@" + strconv.Itoa(i)
+}
+
+// serveData is passed to the page templates
+type serveData struct {
+	Title string
+	File  string
+	Query string
+	Data  interface{}
+}
+
+func (s *server) render(w http.ResponseWriter, page string, data serveData) {
+	data.File = s.file
+	var buf bytes.Buffer
+	if err := s.tmpl.ExecuteTemplate(&buf, page, data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	buf.WriteTo(w)
+}
+
+// pathIndex parses the index following prefix in the request path
+func pathIndex(r *http.Request, prefix string) (int, bool) {
+	i, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, prefix))
+	return i, err == nil && i >= 0
+}
+
+func (s *server) handleIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	s.render(w, "index", serveData{Title: s.file, Data: s.info})
+}
+
+func (s *server) handleClasses(w http.ResponseWriter, r *http.Request) {
+	l := make([]*hl.ClassInfo, 0, len(s.classes))
+	for _, c := range s.classes {
+		l = append(l, c)
+	}
+	sort.Slice(l, func(i, j int) bool { return l[i].Name < l[j].Name })
+	s.render(w, "classes", serveData{Title: "Classes", Data: l})
+}
+
+func (s *server) handleTypes(w http.ResponseWriter, r *http.Request) {
+	s.render(w, "types", serveData{Title: "Types", Data: s.types})
+}
+
+func (s *server) handleFunctions(w http.ResponseWriter, r *http.Request) {
+	s.render(w, "functions", serveData{Title: "Functions", Data: s.functions})
+}
+
+func (s *server) handleNatives(w http.ResponseWriter, r *http.Request) {
+	s.render(w, "natives", serveData{Title: "Natives", Data: s.natives})
+}
+
+func (s *server) handleGlobals(w http.ResponseWriter, r *http.Request) {
+	s.render(w, "globals", serveData{Title: "Globals", Data: s.globals})
+}
+
+func (s *server) handleStrings(w http.ResponseWriter, r *http.Request) {
+	var l []hl.StringInfo
+	for _, pool := range []string{hl.PoolStrings, hl.PoolBytes} {
+		l = append(l, s.strs[pool]...)
+	}
+	s.render(w, "strings", serveData{Title: "Strings", Data: l})
+}
+
+// serveLine is an instruction of a function page
+type serveLine struct {
+	hl.Line
+	HTML template.HTML
+	Note template.HTML
+}
+
+// serveFunction is the content of a function page
+type serveFunction struct {
+	hl.FuncRef
+	Type     int
+	Class    int
+	Native   bool
+	Position string
+	Comment  string
+	Closure  *hl.ClosureInfo
+	Lines    []serveLine
+	Callers  []hl.FuncRef
+	Callees  []hl.FuncRef
+}
+
+func (s *server) handleFunction(w http.ResponseWriter, r *http.Request) {
+	i, ok := pathIndex(r, "/fun/")
+	if !ok || s.hlb.LookupFunction(i) == nil {
+		http.NotFound(w, r)
+		return
+	}
+	f := serveFunction{
+		FuncRef: hl.FuncRef{Index: i, Name: s.hlb.FunctionName(i)},
+		Type:    s.hlb.FunctionType(i),
+		Class:   -1,
+		Native:  s.native[i],
+		Comment: s.hlb.FunctionComment(i),
+	}
+	if c, ok := s.owner[i]; ok {
+		f.Class = c
+	}
+	if c, ok := s.closures[i]; ok {
+		f.Closure = &c
+	}
+	if p, ok := s.hlb.Position(i, 0); ok {
+		f.Position = p.String()
+	}
+	indirect := make(map[int]hl.CallSite)
+	seen := make(map[int]bool)
+	for _, site := range s.hlb.CallSites(i) {
+		if site.Kind != hl.CallDirect {
+			indirect[site.PC] = site
+		}
+		for _, t := range site.Targets {
+			if !seen[t.Index] {
+				seen[t.Index] = true
+				f.Callees = append(f.Callees, t)
+			}
+		}
+	}
+	for _, l := range s.hlb.LinkedListing(i, s.link) {
+		// The callees of indirect calls noted in the listing become links
+		note := template.HTMLEscapeString(l.Note)
+		if site, ok := indirect[l.PC]; ok && len(site.Targets) > 0 {
+			links := make([]string, len(site.Targets))
+			for i, t := range site.Targets {
+				links[i] = string(s.funLink(t))
+			}
+			tl := template.HTMLEscapeString(site.TargetList())
+			note = strings.Replace(note, tl, "-&gt; "+strings.Join(links, " | "), 1)
+		}
+		f.Lines = append(f.Lines, serveLine{l, template.HTML(l.Text), template.HTML(note)})
+	}
+	for _, c := range s.callers[i] {
+		f.Callers = append(f.Callers, hl.FuncRef{Index: c, Name: s.hlb.FunctionName(c)})
+	}
+	s.render(w, "function", serveData{Title: f.Name, Data: f})
+}
+
+// serveType is the content of a type page
+type serveType struct {
+	hl.TypeInfo
+	Class      *hl.ClassInfo
+	Subclasses []int
+	Globals    []int
+	Refs       []hl.FuncRef
+}
+
+func (s *server) handleType(w http.ResponseWriter, r *http.Request) {
+	i, ok := pathIndex(r, "/type/")
+	if !ok || i >= len(s.types) {
+		http.NotFound(w, r)
+		return
+	}
+	t := serveType{
+		TypeInfo:   s.types[i],
+		Class:      s.classes[i],
+		Subclasses: s.subclasses[i],
+		Refs:       s.refs[hl.Entity{Kind: hl.EntityType, Index: i}],
+	}
+	for _, g := range s.globals {
+		if g.Type == t.Name || (g.Owner == t.Name && g.Owner != "") {
+			t.Globals = append(t.Globals, g.Index)
+		}
+	}
+	s.render(w, "type", serveData{Title: t.Name, Data: t})
+}
+
+// serveGlobal is the content of a global page
+type serveGlobal struct {
+	hl.GlobalInfo
+	Label string
+	Refs  []hl.FuncRef
+}
+
+func (s *server) handleGlobal(w http.ResponseWriter, r *http.Request) {
+	i, ok := pathIndex(r, "/global/")
+	if !ok || i >= len(s.globals) {
+		http.NotFound(w, r)
+		return
+	}
+	g := serveGlobal{
+		GlobalInfo: s.globals[i],
+		Label:      s.globalName(i),
+		Refs:       s.refs[hl.Entity{Kind: hl.EntityGlobal, Index: i}],
+	}
+	s.render(w, "global", serveData{Title: g.Label, Data: g})
+}
+
+// serveString is the content of a string page
+type serveString struct {
+	hl.StringInfo
+	Refs []hl.FuncRef
+}
+
+func (s *server) handleString(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/string/")
+	slash := strings.IndexByte(path, '/')
+	if slash < 0 {
+		http.NotFound(w, r)
+		return
+	}
+	pool := path[:slash]
+	i, err := strconv.Atoi(path[slash+1:])
+	l := s.strs[pool]
+	if err != nil || i < 0 || i >= len(l) {
+		http.NotFound(w, r)
+		return
+	}
+	kind := hl.EntityString
+	if pool == hl.PoolBytes {
+		kind = hl.EntityBytes
+	}
+	str := serveString{l[i], s.refs[hl.Entity{Kind: kind, Index: i}]}
+	s.render(w, "string", serveData{Title: fmt.Sprintf("%s #%d", pool, i), Data: str})
+}
+
+// serveSearch holds the matches of a search, by kind
+type serveSearch struct {
+	Functions []hl.FuncRef
+	Types     []hl.TypeInfo
+	Globals   []int
+	Strings   []hl.StringInfo
+	Truncated bool
+}
+
+func (s *server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query().Get("q")
+	match := func(name string) bool {
+		return q != "" && strings.Contains(strings.ToLower(name), strings.ToLower(q))
+	}
+	var res serveSearch
+	full := func(n int) bool {
+		if n >= maxResults {
+			res.Truncated = true
+			return true
+		}
+		return false
+	}
+	for _, f := range s.functions {
+		if match(f.Name) && !full(len(res.Functions)) {
+			res.Functions = append(res.Functions, f)
+		}
+	}
+	for _, lib := range s.natives {
+		for _, n := range lib.Natives {
+			if name := lib.Name + "." + n.Name; match(name) && !full(len(res.Functions)) {
+				res.Functions = append(res.Functions, hl.FuncRef{Index: n.Index, Name: name})
+			}
+		}
+	}
+	for _, t := range s.types {
+		if match(t.Name) && !full(len(res.Types)) {
+			res.Types = append(res.Types, t)
+		}
+	}
+	for i := range s.globals {
+		if match(s.globalName(i)) && !full(len(res.Globals)) {
+			res.Globals = append(res.Globals, i)
+		}
+	}
+	for _, pool := range []string{hl.PoolStrings, hl.PoolBytes} {
+		for _, str := range s.strs[pool] {
+			if match(str.Value) && !full(len(res.Strings)) {
+				res.Strings = append(res.Strings, str)
+			}
+		}
+	}
+	s.render(w, "search", serveData{Title: "Search: " + q, Query: q, Data: res})
+}
+
+// ServeHTTP serializes the requests to the module
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handler.ServeHTTP(w, r)
+}
+
+func (s *server) mux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.handleIndex)
+	mux.HandleFunc("/classes", s.handleClasses)
+	mux.HandleFunc("/types", s.handleTypes)
+	mux.HandleFunc("/functions", s.handleFunctions)
+	mux.HandleFunc("/natives", s.handleNatives)
+	mux.HandleFunc("/globals", s.handleGlobals)
+	mux.HandleFunc("/strings", s.handleStrings)
+	mux.HandleFunc("/search", s.handleSearch)
+	mux.HandleFunc("/fun/", s.handleFunction)
+	mux.HandleFunc("/type/", s.handleType)
+	mux.HandleFunc("/global/", s.handleGlobal)
+	mux.HandleFunc("/string/", s.handleString)
+	return mux
+}
+
+func runServe(args []string) error {
+	fs := newFlagSet("serve")
+	addr := fs.String("addr", "127.0.0.1:8080", "listen on `address`")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		usage()
+	}
+
+	hlb, err := LoadCode(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer hlb.Close()
+	s := newServer(hlb, fs.Arg(0))
+	log.Printf("serving %s on http://%s/", fs.Arg(0), *addr)
+	return http.ListenAndServe(*addr, s)
+}
+
+const serveTemplates = `
+{{define "head"}}<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>{{.Title}} - hldump</title>
+<style>
+body { font-family: sans-serif; margin: 0; color: #222; }
+nav { background: #333; padding: 6px 12px; }
+nav a { color: #eee; margin-right: 12px; text-decoration: none; }
+nav form { display: inline; float: right; }
+main { padding: 8px 16px; }
+a { color: #05c; text-decoration: none; }
+a:hover { text-decoration: underline; }
+a.type { color: #707; }
+a.global { color: #a50; }
+a.str { color: #080; }
+a.native { color: #c00; }
+table { border-collapse: collapse; }
+td, th { padding: 1px 8px; text-align: left; vertical-align: top; }
+tr:nth-child(even) { background: #f4f4f4; }
+.code td { font-family: monospace; white-space: pre; }
+.code tr:target { background: #ffd; }
+.note { color: #777; }
+.meta { color: #555; }
+</style></head>
+<body><nav><a href="/">{{.File}}</a><a href="/classes">Classes</a><a href="/functions">Functions</a><a href="/natives">Natives</a><a href="/globals">Globals</a><a href="/types">Types</a><a href="/strings">Strings</a>
+<form action="/search"><input name="q" value="{{.Query}}" placeholder="search"></form></nav>
+<main><h1>{{.Title}}</h1>
+{{end}}
+
+{{define "foot"}}</main></body></html>
+{{end}}
+
+{{define "refs"}}{{if .}}<ul>{{range .}}<li>{{fun .}}</li>{{end}}</ul>{{else}}<p class="meta">none</p>{{end}}{{end}}
+
+{{define "index"}}{{template "head" .}}{{with .Data}}
+<table>
+<tr><td>Version</td><td>{{.Version}}</td></tr>
+<tr><td>Entry point</td><td>{{fun .EntryPoint}}</td></tr>
+<tr><td>Types</td><td><a href="/types">{{.Types}}</a></td></tr>
+<tr><td>Functions</td><td><a href="/functions">{{.Functions}}</a></td></tr>
+<tr><td>Natives</td><td><a href="/natives">{{.Natives}}</a></td></tr>
+<tr><td>Globals</td><td><a href="/globals">{{.Globals}}</a></td></tr>
+<tr><td>Strings</td><td><a href="/strings">{{.Strings}}</a></td></tr>
+<tr><td>Instructions</td><td>{{.Instructions}}</td></tr>
+</table>
+<h2>Largest functions</h2>
+<table>{{range .Largest}}<tr><td>{{fun .FuncRef}}</td><td>{{.Instructions}} instructions</td></tr>{{end}}</table>
+{{end}}{{template "foot"}}{{end}}
+
+{{define "classes"}}{{template "head" .}}
+<table><tr><th>Class</th><th>Extends</th><th>Fields</th><th>Methods</th></tr>
+{{range .Data}}<tr><td>{{typ .Type}}</td><td>{{if .SuperType}}{{typ .SuperType}}{{end}}</td><td>{{len .Fields}}</td><td>{{len .Methods}}</td></tr>
+{{end}}</table>{{template "foot"}}{{end}}
+
+{{define "types"}}{{template "head" .}}
+<table><tr><th>#</th><th>Kind</th><th>Type</th></tr>
+{{range .Data}}<tr><td>{{.Index}}</td><td>{{.Kind}}</td><td>{{typ .Index}}</td></tr>
+{{end}}</table>{{template "foot"}}{{end}}
+
+{{define "functions"}}{{template "head" .}}
+<table>{{range .Data}}<tr><td>fun@{{.Index}}</td><td>{{fun .}}</td></tr>
+{{end}}</table>{{template "foot"}}{{end}}
+
+{{define "natives"}}{{template "head" .}}{{range .Data}}
+<h2>{{.Name}}</h2>
+<table>{{range .Natives}}<tr><td><a class="native" href="/fun/{{.Index}}">{{.Name}}</a></td><td>{{.Signature}}</td><td>{{len .CalledBy}} callers</td></tr>
+{{end}}</table>{{end}}{{template "foot"}}{{end}}
+
+{{define "globals"}}{{template "head" .}}
+<table><tr><th>#</th><th>Global</th><th>Type</th><th>Set by</th></tr>
+{{range .Data}}<tr><td>{{.Index}}</td><td>{{global .Index}}</td><td>{{.Type}}</td><td>{{range .InitBy}}{{fun .}} {{end}}</td></tr>
+{{end}}</table>{{template "foot"}}{{end}}
+
+{{define "strings"}}{{template "head" .}}
+<table><tr><th>Pool</th><th>#</th><th>Length</th><th>Value</th></tr>
+{{range .Data}}<tr><td>{{.Pool}}</td><td>{{.Index}}</td><td>{{.Length}}</td><td>{{str .}}</td></tr>
+{{end}}</table>{{template "foot"}}{{end}}
+
+{{define "function"}}{{template "head" .}}{{with .Data}}
+<p class="meta">fun@{{.Index}}{{if ge .Type 0}} : {{typ .Type}}{{end}}{{if .Native}} (native){{end}}
+{{if ge .Class 0}}<br>method of {{typ .Class}}{{end}}
+{{with .Closure}}<br>closure created by {{fun .Owner}} <a href="/fun/{{.Owner.Index}}#pc{{.PC}}">@{{.PC}}</a>{{if .Env}}, captures {{.Env}}{{end}}{{end}}
+{{if .Position}}<br>{{.Position}}{{end}}
+{{if .Comment}}<br>{{.Comment}}{{end}}</p>
+{{if .Lines}}<table class="code">{{range .Lines}}<tr{{if ge .PC 0}} id="pc{{.PC}}"{{end}}><td>{{if ge .PC 0}}<a href="#pc{{.PC}}">@{{.PC}}</a>{{end}}</td><td>{{.HTML}}</td><td class="note">{{.Note}}</td></tr>
+{{end}}</table>{{end}}
+<h2>Callers</h2>{{template "refs" .Callers}}
+{{if .Callees}}<h2>Calls</h2>{{template "refs" .Callees}}{{end}}
+{{end}}{{template "foot"}}{{end}}
+
+{{define "type"}}{{template "head" .}}{{with .Data}}
+<p class="meta">{{.Kind}} type #{{.Index}}</p>
+{{with .Class}}
+{{if .SuperType}}<p>extends {{typ .SuperType}}</p>{{end}}
+<h2>Fields</h2>{{if .Fields}}<table>{{range .Fields}}<tr><td>{{.Name}}</td><td>{{typ .TypeIndex}}</td></tr>{{end}}</table>{{else}}<p class="meta">none</p>{{end}}
+<h2>Methods</h2>{{template "refs" .Methods}}
+{{end}}
+{{if .Subclasses}}<h2>Subclasses</h2><ul>{{range .Subclasses}}<li>{{typ .}}</li>{{end}}</ul>{{end}}
+{{if .Globals}}<h2>Globals</h2><ul>{{range .Globals}}<li>{{global .}}</li>{{end}}</ul>{{end}}
+<h2>Instantiated by</h2>{{template "refs" .Refs}}
+{{end}}{{template "foot"}}{{end}}
+
+{{define "global"}}{{template "head" .}}{{with .Data}}
+<p class="meta">global@{{.Index}} : {{.Type}}{{if .Owner}}, backs {{.OwnerKind}} {{.Owner}}{{end}}</p>
+{{if .Comment}}<p>{{.Comment}}</p>{{end}}
+{{if .Constant}}<h2>Constant</h2><table>{{range .Constant}}<tr><td>{{.Name}}</td><td>{{.Type}}</td><td>{{.Value}}</td></tr>{{end}}</table>{{end}}
+<h2>Set by</h2>{{template "refs" .InitBy}}
+<h2>Referenced by</h2>{{template "refs" .Refs}}
+{{end}}{{template "foot"}}{{end}}
+
+{{define "string"}}{{template "head" .}}{{with .Data}}
+<p class="meta">{{.Length}} bytes</p>
+<pre>{{.Value}}</pre>
+<h2>Loaded by</h2>{{template "refs" .Refs}}
+{{end}}{{template "foot"}}{{end}}
+
+{{define "search"}}{{template "head" .}}{{with .Data}}
+{{if .Truncated}}<p class="meta">Only the first matches of each kind are listed.</p>{{end}}
+{{if .Functions}}<h2>Functions</h2>{{template "refs" .Functions}}{{end}}
+{{if .Types}}<h2>Types</h2><ul>{{range .Types}}<li>{{typ .Index}}</li>{{end}}</ul>{{end}}
+{{if .Globals}}<h2>Globals</h2><ul>{{range .Globals}}<li>{{global .}}</li>{{end}}</ul>{{end}}
+{{if .Strings}}<h2>Strings</h2><ul>{{range .Strings}}<li>{{str .}}</li>{{end}}</ul>{{end}}
+{{end}}{{template "foot"}}{{end}}
+`
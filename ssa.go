@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+import (
+	hl "github.com/c0rner/hldump/internal/hashlink"
+)
+
+// printSSA prints function fn in SSA form
+func printSSA(fn *hl.SSAFunc) {
+	fmt.Printf("fun@%d %s\n", fn.Index, fn.Name)
+	for _, b := range fn.Blocks {
+		fmt.Printf("  b%d:", b.Index)
+		if len(b.Preds) > 0 {
+			preds := make([]string, len(b.Preds))
+			for i, p := range b.Preds {
+				preds[i] = "b" + strconv.Itoa(p.Index)
+			}
+			fmt.Printf(" <- %s", strings.Join(preds, ", "))
+		}
+		fmt.Println()
+		if b.Index == 0 {
+			for _, v := range fn.Params {
+				fmt.Printf("\t%s\n", fn.Format(v))
+			}
+			for _, v := range fn.Undef {
+				fmt.Printf("\t%s\n", fn.Format(v))
+			}
+		}
+		for _, v := range b.Phis {
+			fmt.Printf("\t%s\n", fn.Format(v))
+		}
+		for _, v := range b.Instrs {
+			fmt.Printf("\t@%d %s\n", v.PC, fn.Format(v))
+		}
+	}
+}
+
+func runSSA(args []string) error {
+	fs := newFlagSet("ssa")
+	fs.Parse(args)
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		usage()
+	}
+
+	hlb, err := LoadCode(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer hlb.Close()
+
+	if fs.NArg() == 2 {
+		i, ok := findFunction(hlb, fs.Arg(1))
+		if !ok {
+			return fmt.Errorf("unknown function %q", fs.Arg(1))
+		}
+		fn := hlb.SSA(i)
+		if fn == nil {
+			return fmt.Errorf("%s is not a bytecode function", fs.Arg(1))
+		}
+		printSSA(fn)
+		return nil
+	}
+
+	return hl.NewPassManager(hl.PassFunc{
+		PassName: "print",
+		Func: func(fn *hl.SSAFunc) error {
+			printSSA(fn)
+			return nil
+		},
+	}).Run(hlb)
+}
+
+// findFunction resolves a function given as fun@N or by name
+func findFunction(hlb *hl.Data, name string) (int, bool) {
+	if strings.HasPrefix(name, "fun@") {
+		i, err := strconv.Atoi(name[4:])
+		return i, err == nil
+	}
+	return hlb.FindFunction(name)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+import (
+	hl "github.com/c0rner/hldump/internal/hashlink"
+)
+
+// statsTable is one table of the stats report
+type statsTable struct {
+	name   string
+	header []string
+	rows   [][]string
+}
+
+func statsTables(s *hl.Stats) []statsTable {
+	itoa := strconv.Itoa
+	t := []statsTable{
+		{name: "opcodes", header: []string{"op", "count"}},
+		{name: "classes", header: []string{"class", "functions", "instructions"}},
+		{name: "packages", header: []string{"package", "functions", "instructions"}},
+		{name: "functions", header: []string{"index", "name", "instructions", "registers", "fanin", "fanout"}},
+		{name: "natives", header: []string{"index", "name", "calls"}},
+		{name: "strings", header: []string{"package", "strings", "bytes"}},
+	}
+	for _, o := range s.Opcodes {
+		t[0].rows = append(t[0].rows, []string{o.Op, itoa(o.Count)})
+	}
+	for _, c := range s.Classes {
+		t[1].rows = append(t[1].rows, []string{c.Name, itoa(c.Functions), itoa(c.Instructions)})
+	}
+	for _, c := range s.Packages {
+		t[2].rows = append(t[2].rows, []string{c.Name, itoa(c.Functions), itoa(c.Instructions)})
+	}
+	for _, f := range s.Functions {
+		t[3].rows = append(t[3].rows, []string{itoa(f.Index), f.Name, itoa(f.Instructions), itoa(f.Registers), itoa(f.FanIn), itoa(f.FanOut)})
+	}
+	for _, n := range s.NativeCalls {
+		t[4].rows = append(t[4].rows, []string{itoa(n.Index), n.Name, itoa(n.Calls)})
+	}
+	for _, p := range s.Strings {
+		t[5].rows = append(t[5].rows, []string{p.Package, itoa(p.Strings), itoa(p.Bytes)})
+	}
+	return t
+}
+
+func runStats(args []string) error {
+	fs := newFlagSet("stats")
+	asJSON := fs.Bool("json", false, "output JSON")
+	asCSV := fs.Bool("csv", false, "output CSV")
+	table := fs.String("table", "", "only output `table` (opcodes, classes, packages, functions, natives or strings)")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		usage()
+	}
+
+	hlb, err := LoadCode(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer hlb.Close()
+
+	stats := hlb.Stats()
+	if *asJSON {
+		return writeJSON(stats)
+	}
+
+	var tables []statsTable
+	for _, t := range statsTables(stats) {
+		if *table == "" || *table == t.name {
+			tables = append(tables, t)
+		}
+	}
+	if len(tables) == 0 {
+		return fmt.Errorf("unknown table %q", *table)
+	}
+
+	if *asCSV {
+		// Tables are separated by their header rows, use -table
+		// to get a single table
+		w := csv.NewWriter(os.Stdout)
+		for _, t := range tables {
+			if err := w.Write(t.header); err != nil {
+				return err
+			}
+			if err := w.WriteAll(t.rows); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for i, t := range tables {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("%s:\n", strings.ToUpper(t.name[:1])+t.name[1:])
+		fmt.Printf("\t%s\n", strings.Join(t.header, "\t"))
+		for _, r := range t.rows {
+			fmt.Printf("\t%s\n", strings.Join(r, "\t"))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+)
+
+import (
+	hl "github.com/c0rner/hldump/internal/hashlink"
+)
+
+// Stack frames are given either as a function index with an optional
+// instruction offset, eg. "fun@1234 pc 56" or "fun@1234:56", or as a
+// qualified method name such as "$Class.method".
+var (
+	rawFrame  = regexp.MustCompile(`fun@(\d+)(?:(?:\s*pc\s*|:|\+)(\d+))?`)
+	nameFrame = regexp.MustCompile(`\$?[A-Za-z_][\w]*(?:\.[A-Za-z_$][\w$]*)+`)
+)
+
+// symbolizeFrame describes function fn at instruction pc. Without an
+// instruction, a pc of -1, only the file of the function is given.
+func symbolizeFrame(hlb *hl.Data, fn, pc int) string {
+	s := hlb.FunctionName(fn)
+	if pc < 0 {
+		if pos, ok := hlb.Position(fn, 0); ok {
+			s += " (" + pos.File + ")"
+		}
+	} else if pos, ok := hlb.Position(fn, pc); ok {
+		s += " (" + pos.String() + ")"
+	}
+	return s
+}
+
+func runSymbolize(args []string) error {
+	fs := newFlagSet("symbolize")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		usage()
+	}
+
+	hlb, err := LoadHLB(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer hlb.Close()
+
+	w := bufio.NewWriter(os.Stdout)
+	sc := bufio.NewScanner(os.Stdin)
+	for sc.Scan() {
+		line := sc.Text()
+		if rawFrame.MatchString(line) {
+			line = rawFrame.ReplaceAllStringFunc(line, func(m string) string {
+				sub := rawFrame.FindStringSubmatch(m)
+				fn, _ := strconv.Atoi(sub[1])
+				pc := -1
+				if sub[2] != "" {
+					pc, _ = strconv.Atoi(sub[2])
+				}
+				return symbolizeFrame(hlb, fn, pc)
+			})
+		} else {
+			line = nameFrame.ReplaceAllStringFunc(line, func(m string) string {
+				fn, ok := hlb.FindFunction(m)
+				if !ok {
+					return m
+				}
+				return symbolizeFrame(hlb, fn, -1)
+			})
+		}
+		fmt.Fprintln(w, line)
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	return w.Flush()
+}
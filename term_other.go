@@ -0,0 +1,19 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// rawMode is not supported on this system
+func rawMode(fd int) (func(), error) {
+	return nil, errors.New("terminal UI is not supported on this system")
+}
+
+func termSize(fd int) (int, int, bool) {
+	return 0, 0, false
+}
+
+func notifyResize(c chan<- os.Signal) {}
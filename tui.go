@@ -0,0 +1,802 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+import (
+	hl "github.com/c0rner/hldump/internal/hashlink"
+)
+
+var errNoTerminal = errors.New("standard input is not a terminal")
+
+// Panes of the terminal UI, in focus order
+const (
+	paneTree = iota
+	paneCode
+	paneXrefs
+	numPanes
+)
+
+const tuiHelp = "tab pane  enter open  [ ] back/forward  x callers  / strings  : go to  n rename  v ssa  q quit"
+
+// listView is the cursor and scroll position of a pane
+type listView struct {
+	cur, top int
+}
+
+// move moves the cursor by delta within n rows, scrolling so that it
+// stays within the h visible rows
+func (v *listView) move(delta, n, h int) {
+	v.cur += delta
+	if v.cur >= n {
+		v.cur = n - 1
+	}
+	if v.cur < 0 {
+		v.cur = 0
+	}
+	if v.cur < v.top {
+		v.top = v.cur
+	}
+	if h > 0 && v.cur >= v.top+h {
+		v.top = v.cur - h + 1
+	}
+}
+
+// tuiGroup is a class, or the functions belonging to none, in the tree
+type tuiGroup struct {
+	name  string
+	class string
+	fns   []hl.FuncRef
+	open  bool
+}
+
+// treeRow is a line of the tree pane: a group or one of its functions
+type treeRow struct {
+	group int
+	fn    int // index into the functions of the group, or -1
+}
+
+// tuiJump is a destination listed in the xrefs pane. The line
+// selected is the first one calling function call, or else the first
+// one containing find.
+type tuiJump struct {
+	label string
+	fn    int
+	call  int
+	find  string
+}
+
+// tuiLoc is a position in the navigation history
+type tuiLoc struct {
+	fn, line int
+}
+
+type tui struct {
+	hlb     *hl.Data
+	file    string
+	symPath string
+	out     *bufio.Writer
+	width   int
+	height  int
+
+	focus  int
+	groups []*tuiGroup
+	rows   []treeRow
+	tree   listView
+	code   listView
+	xref   listView
+
+	fn    int
+	ssa   bool
+	lines []hl.Line
+
+	xrefTitle string
+	xrefs     []tuiJump
+	callers   map[int][]int
+
+	back   []tuiLoc
+	fwd    []tuiLoc
+	status string
+
+	prompt  string
+	input   []rune
+	onInput func(string)
+	quit    bool
+}
+
+func newTUI(hlb *hl.Data, file, symPath string, out io.Writer) *tui {
+	t := &tui{hlb: hlb, file: file, symPath: symPath, out: bufio.NewWriter(out), fn: -1, width: 80, height: 24}
+	t.buildTree()
+	return t
+}
+
+// buildTree groups the functions by class, keeping expanded groups open
+func (t *tui) buildTree() {
+	open := make(map[string]bool)
+	for _, g := range t.groups {
+		open[g.name] = g.open
+	}
+
+	t.groups = t.groups[:0]
+	seen := make(map[int]bool)
+	for _, c := range t.hlb.Classes() {
+		g := &tuiGroup{name: c.Name, class: c.Name, fns: c.Methods}
+		if c.Super != "" {
+			g.name += " : " + c.Super
+		}
+		for _, f := range c.Methods {
+			seen[f.Index] = true
+		}
+		t.groups = append(t.groups, g)
+	}
+	sort.SliceStable(t.groups, func(i, j int) bool { return t.groups[i].name < t.groups[j].name })
+	other := &tuiGroup{name: "(functions)"}
+	for _, f := range t.hlb.Functions() {
+		if !seen[f.Index] {
+			other.fns = append(other.fns, f)
+		}
+	}
+	if len(other.fns) > 0 {
+		t.groups = append(t.groups, other)
+	}
+	for _, g := range t.groups {
+		g.open = open[g.name]
+	}
+	t.buildRows()
+}
+
+func (t *tui) buildRows() {
+	t.rows = t.rows[:0]
+	for i, g := range t.groups {
+		t.rows = append(t.rows, treeRow{i, -1})
+		if g.open {
+			for j := range g.fns {
+				t.rows = append(t.rows, treeRow{i, j})
+			}
+		}
+	}
+	t.tree.move(0, len(t.rows), t.bodyHeight())
+}
+
+func (t *tui) treeLabel(r treeRow) string {
+	g := t.groups[r.group]
+	if r.fn < 0 {
+		mark := "+"
+		if g.open {
+			mark = "-"
+		}
+		return fmt.Sprintf("%s %s (%d)", mark, g.name, len(g.fns))
+	}
+	name := g.fns[r.fn].Name
+	if g.class != "" {
+		name = strings.TrimPrefix(name, g.class+".")
+	}
+	return "    " + name
+}
+
+// Pane sizes, leaving a title and a status line
+func (t *tui) bodyHeight() int { return atLeast(t.height-2, 1) }
+func (t *tui) codeHeight() int { return atLeast(t.bodyHeight()*2/3, 1) }
+func (t *tui) xrefHeight() int { return atLeast(t.bodyHeight()-t.codeHeight()-1, 1) }
+
+func (t *tui) treeWidth() int {
+	if w := t.width / 3; w < 48 {
+		return atLeast(w, 16)
+	}
+	return 48
+}
+
+func atLeast(v, n int) int {
+	if v < n {
+		return n
+	}
+	return v
+}
+
+// listing returns the lines of function fn in the current view
+func (t *tui) listing(fn int) []hl.Line {
+	lines := t.hlb.Listing(fn)
+	if !t.ssa || lines == nil {
+		return lines
+	}
+	f := t.hlb.SSA(fn)
+	calls := make(map[int][]hl.FuncRef)
+	for _, l := range lines {
+		if l.PC >= 0 {
+			calls[l.PC] = l.Calls
+		}
+	}
+
+	var res []hl.Line
+	for _, b := range f.Blocks {
+		head := "b" + strconv.Itoa(b.Index) + ":"
+		if len(b.Preds) > 0 {
+			preds := make([]string, len(b.Preds))
+			for i, p := range b.Preds {
+				preds[i] = "b" + strconv.Itoa(p.Index)
+			}
+			head += " <- " + strings.Join(preds, ", ")
+		}
+		res = append(res, hl.Line{PC: -1, Text: head})
+		var values []*hl.Value
+		if b.Index == 0 {
+			values = append(append(values, f.Params...), f.Undef...)
+		}
+		for _, v := range append(values, b.Phis...) {
+			res = append(res, hl.Line{PC: -1, Text: "  " + f.Format(v)})
+		}
+		for _, v := range b.Instrs {
+			res = append(res, hl.Line{PC: v.PC, Text: f.Format(v), Calls: calls[v.PC]})
+		}
+	}
+	return res
+}
+
+// open shows function fn, recording the current position in the history
+func (t *tui) open(j tuiJump) {
+	lines := t.listing(j.fn)
+	if lines == nil {
+		t.status = t.hlb.FunctionName(j.fn) + " is not a bytecode function"
+		return
+	}
+	if t.fn >= 0 {
+		t.back = append(t.back, tuiLoc{t.fn, t.code.cur})
+		t.fwd = nil
+	}
+	t.show(j.fn, locate(lines, j), lines)
+	t.focus = paneCode
+}
+
+// locate returns the line of lines selected by j
+func locate(lines []hl.Line, j tuiJump) int {
+	for i, l := range lines {
+		for _, c := range l.Calls {
+			if c.Index == j.call {
+				return i
+			}
+		}
+	}
+	if j.find != "" {
+		for i, l := range lines {
+			if strings.Contains(l.Text, j.find) {
+				return i
+			}
+		}
+	}
+	return 0
+}
+
+func (t *tui) show(fn, line int, lines []hl.Line) {
+	t.fn, t.lines = fn, lines
+	t.code = listView{cur: line, top: atLeast(line-t.codeHeight()/3, 0)}
+	t.code.move(0, len(lines), t.codeHeight())
+}
+
+func (t *tui) goBack() {
+	if len(t.back) == 0 {
+		t.status = "no previous function"
+		return
+	}
+	loc := t.back[len(t.back)-1]
+	t.back = t.back[:len(t.back)-1]
+	t.fwd = append(t.fwd, tuiLoc{t.fn, t.code.cur})
+	t.show(loc.fn, loc.line, t.listing(loc.fn))
+}
+
+func (t *tui) goForward() {
+	if len(t.fwd) == 0 {
+		t.status = "no next function"
+		return
+	}
+	loc := t.fwd[len(t.fwd)-1]
+	t.fwd = t.fwd[:len(t.fwd)-1]
+	t.back = append(t.back, tuiLoc{t.fn, t.code.cur})
+	t.show(loc.fn, loc.line, t.listing(loc.fn))
+}
+
+func (t *tui) setXrefs(title string, l []tuiJump) {
+	t.xrefTitle, t.xrefs = title, l
+	t.xref = listView{}
+	if len(l) == 0 {
+		t.status = title + ": none"
+		return
+	}
+	t.focus = paneXrefs
+}
+
+// selected returns the function under the cursor of the focused pane
+func (t *tui) selected() (int, bool) {
+	switch t.focus {
+	case paneTree:
+		if t.tree.cur < len(t.rows) {
+			if r := t.rows[t.tree.cur]; r.fn >= 0 {
+				return t.groups[r.group].fns[r.fn].Index, true
+			}
+		}
+	case paneCode:
+		return t.fn, t.fn >= 0
+	case paneXrefs:
+		if t.xref.cur < len(t.xrefs) && t.xrefs[t.xref.cur].fn >= 0 {
+			return t.xrefs[t.xref.cur].fn, true
+		}
+	}
+	return 0, false
+}
+
+func (t *tui) showCallers(fn int) {
+	if t.callers == nil {
+		t.callers = t.hlb.Callers()
+	}
+	var l []tuiJump
+	for _, c := range t.callers[fn] {
+		l = append(l, tuiJump{label: t.hlb.FunctionName(c), fn: c, call: fn})
+	}
+	t.setXrefs("Callers of "+t.hlb.FunctionName(fn), l)
+}
+
+func (t *tui) search(expr string) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		t.status = err.Error()
+		return
+	}
+	var l []tuiJump
+	for _, pool := range []string{hl.PoolStrings, hl.PoolBytes} {
+		for _, s := range t.hlb.FindStrings(pool, re.Match, true) {
+			if len(s.LoadedBy) == 0 {
+				l = append(l, tuiJump{label: s.Value + "  (unused)", fn: -1})
+			}
+			for _, f := range s.LoadedBy {
+				l = append(l, tuiJump{label: s.Value + "  " + f.Name, fn: f.Index, call: -1, find: s.Value})
+			}
+		}
+	}
+	t.setXrefs("Strings matching "+expr, l)
+}
+
+func (t *tui) goTo(name string) {
+	fn, ok := findFunction(t.hlb, name)
+	if !ok {
+		t.status = "unknown function " + name
+		return
+	}
+	t.open(tuiJump{fn: fn, call: -1})
+}
+
+// rename names function fn and saves the symbol map
+func (t *tui) rename(fn int, name string) {
+	m := t.hlb.Symbols()
+	if m == nil {
+		m = hl.NewSymbolMap()
+	}
+	s := hl.Symbol{Name: name}
+	if old := m.Functions[fn]; old != nil {
+		s.Comment = old.Comment
+	}
+	m.SetFunction(fn, s)
+	t.hlb.SetSymbols(m)
+
+	t.buildTree()
+	if t.fn >= 0 {
+		t.lines = t.listing(t.fn)
+	}
+	if err := saveSymbols(m, t.symPath); err != nil {
+		t.status = err.Error()
+		return
+	}
+	t.status = "saved " + t.symPath
+}
+
+func saveSymbols(m *hl.SymbolMap, name string) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := m.Write(f, symbolFormat(name)); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ask prompts for a line of input passed to fn
+func (t *tui) ask(prompt, value string, fn func(string)) {
+	t.prompt, t.input, t.onInput = prompt, []rune(value), fn
+}
+
+func (t *tui) edit(k string) {
+	switch k {
+	case "enter":
+		fn, s := t.onInput, string(t.input)
+		t.prompt = ""
+		if s != "" {
+			fn(s)
+		}
+	case "esc", "ctrl-c":
+		t.prompt = ""
+	case "backspace":
+		if len(t.input) > 0 {
+			t.input = t.input[:len(t.input)-1]
+		}
+	default:
+		if utf8.RuneCountInString(k) == 1 {
+			t.input = append(t.input, []rune(k)...)
+		}
+	}
+}
+
+// move moves the cursor of the focused pane
+func (t *tui) move(delta int) {
+	switch t.focus {
+	case paneTree:
+		t.tree.move(delta, len(t.rows), t.bodyHeight())
+	case paneCode:
+		t.code.move(delta, len(t.lines), t.codeHeight())
+	case paneXrefs:
+		t.xref.move(delta, len(t.xrefs), t.xrefHeight())
+	}
+}
+
+func (t *tui) enter() {
+	switch t.focus {
+	case paneTree:
+		if t.tree.cur >= len(t.rows) {
+			return
+		}
+		r := t.rows[t.tree.cur]
+		g := t.groups[r.group]
+		if r.fn < 0 {
+			g.open = !g.open
+			t.buildRows()
+			return
+		}
+		t.open(tuiJump{fn: g.fns[r.fn].Index, call: -1})
+	case paneCode:
+		if t.code.cur >= len(t.lines) {
+			return
+		}
+		l := t.lines[t.code.cur]
+		switch len(l.Calls) {
+		case 0:
+			t.status = "no call on this line"
+		case 1:
+			t.open(tuiJump{fn: l.Calls[0].Index, call: -1})
+		default:
+			j := make([]tuiJump, len(l.Calls))
+			for i, c := range l.Calls {
+				j[i] = tuiJump{label: c.Name, fn: c.Index, call: -1}
+			}
+			t.setXrefs("Targets of @"+strconv.Itoa(l.PC), j)
+		}
+	case paneXrefs:
+		if t.xref.cur < len(t.xrefs) && t.xrefs[t.xref.cur].fn >= 0 {
+			t.open(t.xrefs[t.xref.cur])
+		}
+	}
+}
+
+// expand opens or closes the group under the tree cursor
+func (t *tui) expand(open bool) {
+	if t.focus != paneTree || t.tree.cur >= len(t.rows) {
+		return
+	}
+	r := t.rows[t.tree.cur]
+	t.groups[r.group].open = open
+	t.buildRows()
+	if !open {
+		for i, row := range t.rows {
+			if row.group == r.group && row.fn < 0 {
+				t.tree.cur = i
+			}
+		}
+		t.tree.move(0, len(t.rows), t.bodyHeight())
+	}
+}
+
+func (t *tui) key(k string) {
+	if t.prompt != "" {
+		t.edit(k)
+		return
+	}
+	t.status = ""
+	page := t.codeHeight()
+	switch k {
+	case "q", "ctrl-c":
+		t.quit = true
+	case "tab":
+		t.focus = (t.focus + 1) % numPanes
+	case "btab":
+		t.focus = (t.focus + numPanes - 1) % numPanes
+	case "up", "k":
+		t.move(-1)
+	case "down", "j":
+		t.move(1)
+	case "pgup":
+		t.move(-page)
+	case "pgdn", " ":
+		t.move(page)
+	case "home", "g":
+		t.move(-1 << 30)
+	case "end", "G":
+		t.move(1 << 30)
+	case "left", "h":
+		t.expand(false)
+	case "right", "l":
+		t.expand(true)
+	case "enter":
+		t.enter()
+	case "[", "backspace":
+		t.goBack()
+	case "]":
+		t.goForward()
+	case "x":
+		if fn, ok := t.selected(); ok {
+			t.showCallers(fn)
+		}
+	case "/":
+		t.ask("search strings: ", "", t.search)
+	case ":":
+		t.ask("go to function: ", "", t.goTo)
+	case "n":
+		if fn, ok := t.selected(); ok {
+			t.ask("rename "+t.hlb.FunctionName(fn)+": ", t.hlb.FunctionName(fn), func(s string) { t.rename(fn, s) })
+		}
+	case "v":
+		t.ssa = !t.ssa
+		if t.fn >= 0 {
+			pc := -1
+			if t.code.cur < len(t.lines) {
+				pc = t.lines[t.code.cur].PC
+			}
+			lines := t.listing(t.fn)
+			line := 0
+			for i, l := range lines {
+				if pc >= 0 && l.PC == pc {
+					line = i
+					break
+				}
+			}
+			t.show(t.fn, line, lines)
+		}
+	}
+}
+
+// fit pads or truncates s to w columns
+func fit(s string, w int) string {
+	// Control characters would move the cursor or change the terminal
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, s)
+	if n := utf8.RuneCountInString(s); n < w {
+		return s + strings.Repeat(" ", w-n)
+	} else if n > w {
+		return string([]rune(s)[:w])
+	}
+	return s
+}
+
+// item formats row i of a pane, highlighting the cursor
+func (t *tui) item(v *listView, pane, i int, text string, w int) string {
+	text = fit(text, w)
+	if v.top+i != v.cur {
+		return text
+	}
+	if t.focus == pane {
+		return "\x1b[7m" + text + "\x1b[0m"
+	}
+	return "\x1b[1m" + text + "\x1b[0m"
+}
+
+func (t *tui) codeLine(i, w int) string {
+	n := t.code.top + i
+	if n >= len(t.lines) {
+		return fit("", w)
+	}
+	l := t.lines[n]
+	text := "       " + l.Text
+	if l.PC >= 0 {
+		text = fmt.Sprintf("%6s ", "@"+strconv.Itoa(l.PC)) + l.Text
+	}
+	if l.Note != "" {
+		text += " ; " + l.Note
+	}
+	return t.item(&t.code, paneCode, i, text, w)
+}
+
+func (t *tui) draw() {
+	lw := t.treeWidth()
+	rw := atLeast(t.width-lw-1, 1)
+	ch := t.codeHeight()
+
+	title := " hldump " + t.file
+	if t.fn >= 0 {
+		view := "disassembly"
+		if t.ssa {
+			view = "ssa"
+		}
+		title += "  |  " + t.hlb.FunctionName(t.fn) + " fun@" + strconv.Itoa(t.fn) + "  [" + view + "]"
+	}
+	t.out.WriteString("\x1b[H\x1b[7m" + fit(title, t.width) + "\x1b[0m\r\n")
+
+	for i := 0; i < t.bodyHeight(); i++ {
+		left := fit("", lw)
+		if n := t.tree.top + i; n < len(t.rows) {
+			left = t.item(&t.tree, paneTree, i, t.treeLabel(t.rows[n]), lw)
+		}
+		var right string
+		switch {
+		case i < ch:
+			right = t.codeLine(i, rw)
+		case i == ch:
+			head := "── " + t.xrefTitle + " "
+			right = fit(head+strings.Repeat("─", rw), rw)
+		default:
+			right = fit("", rw)
+			if n := t.xref.top + i - ch - 1; n < len(t.xrefs) {
+				right = t.item(&t.xref, paneXrefs, i-ch-1, "  "+t.xrefs[n].label, rw)
+			}
+		}
+		t.out.WriteString(left + "│" + right + "\r\n")
+	}
+
+	switch {
+	case t.prompt != "":
+		line := t.prompt + string(t.input)
+		t.out.WriteString(fit(line, t.width))
+		col := utf8.RuneCountInString(line) + 1
+		if col > t.width {
+			col = t.width
+		}
+		fmt.Fprintf(t.out, "\x1b[%d;%dH\x1b[?25h", t.height, col)
+	case t.status != "":
+		t.out.WriteString(fit(" "+t.status, t.width) + "\x1b[?25l")
+	default:
+		t.out.WriteString("\x1b[2m" + fit(" "+tuiHelp, t.width) + "\x1b[0m\x1b[?25l")
+	}
+}
+
+// escapeKeys names the escape sequences of special keys
+var escapeKeys = map[string]string{
+	"[A": "up", "[B": "down", "[C": "right", "[D": "left",
+	"OA": "up", "OB": "down", "OC": "right", "OD": "left",
+	"[H": "home", "[F": "end", "OH": "home", "OF": "end",
+	"[1~": "home", "[4~": "end", "[5~": "pgup", "[6~": "pgdn",
+	"[Z": "btab",
+}
+
+// parseKeys splits terminal input into key names. Printable keys are
+// named by their character.
+func parseKeys(b []byte) []string {
+	var res []string
+	for len(b) > 0 {
+		switch c := b[0]; {
+		case c == 0x1b:
+			n := 1
+			k := "esc"
+			if len(b) > 2 && (b[1] == '[' || b[1] == 'O') {
+				for i := 2; i < len(b); i++ {
+					if b[i] >= 0x40 && b[i] <= 0x7e {
+						k, n = escapeKeys[string(b[1:i+1])], i+1
+						break
+					}
+				}
+			}
+			res = append(res, k)
+			b = b[n:]
+		case c == '\r' || c == '\n':
+			res = append(res, "enter")
+			b = b[1:]
+		case c == '\t':
+			res = append(res, "tab")
+			b = b[1:]
+		case c == 0x7f || c == 0x08:
+			res = append(res, "backspace")
+			b = b[1:]
+		case c == 0x03:
+			res = append(res, "ctrl-c")
+			b = b[1:]
+		case c < 0x20:
+			b = b[1:]
+		default:
+			r, n := utf8.DecodeRune(b)
+			res = append(res, string(r))
+			b = b[n:]
+		}
+	}
+	return res
+}
+
+func readKeys(r io.Reader, keys chan<- string) {
+	defer close(keys)
+	buf := make([]byte, 256)
+	for {
+		n, err := r.Read(buf)
+		if err != nil {
+			return
+		}
+		for _, k := range parseKeys(buf[:n]) {
+			keys <- k
+		}
+	}
+}
+
+func (t *tui) run(in *os.File) error {
+	keys := make(chan string, 16)
+	go readKeys(in, keys)
+	resize := make(chan os.Signal, 1)
+	notifyResize(resize)
+
+	t.out.WriteString("\x1b[?1049h")
+	defer func() {
+		t.out.WriteString("\x1b[?25h\x1b[?1049l")
+		t.out.Flush()
+	}()
+	for !t.quit {
+		if w, h, ok := termSize(int(in.Fd())); ok {
+			t.width, t.height = w, h
+		}
+		t.draw()
+		if err := t.out.Flush(); err != nil {
+			return err
+		}
+		select {
+		case k, ok := <-keys:
+			if !ok {
+				return nil
+			}
+			if k != "" {
+				t.key(k)
+			}
+		case <-resize:
+		}
+	}
+	return nil
+}
+
+func runTUI(args []string) error {
+	fs := newFlagSet("tui")
+	fs.Parse(args)
+	if fs.NArg() != 1 || fs.Arg(0) == "-" {
+		usage()
+	}
+
+	// Renames are saved to the symbol map, by default next to the module
+	symPath := symbolFile
+	if symPath == "" {
+		symPath = fs.Arg(0) + ".symbols.json"
+	}
+	if _, err := os.Stat(symPath); err == nil {
+		symbolFile = symPath
+	} else if !os.IsNotExist(err) {
+		return err
+	} else {
+		symbolFile = ""
+	}
+
+	hlb, err := LoadCode(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer hlb.Close()
+
+	restore, err := rawMode(int(os.Stdin.Fd()))
+	if err != nil {
+		return err
+	}
+	defer restore()
+	return newTUI(hlb, fs.Arg(0), symPath, os.Stdout).run(os.Stdin)
+}